@@ -0,0 +1,230 @@
+// -*- Go -*-
+/* ------------------------------------------------ */
+/* Golang source                                    */
+/* Author: Alexei Panov <me@elemc.name> 			*/
+/* ------------------------------------------------ */
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+const (
+	appealStatusNew      = "new"
+	appealStatusPending  = "pending"
+	appealStatusAccepted = "accepted"
+	appealStatusRejected = "rejected"
+
+	callbackAppeal       = "appeal"
+	callbackAppealAccept = "appeal_accept"
+	callbackAppealReject = "appeal_reject"
+)
+
+// floodAppealOffer creates appeal for kicked flooder and offers it to the user in private chat
+func floodAppealOffer(chat *tgbotapi.Chat, user *tgbotapi.User) {
+	appeal := FloodAppeal{
+		ChatID:       chat.ID,
+		ChatTitle:    chat.Title,
+		ChatUserName: chat.UserName,
+		UserID:       user.ID,
+		UserName:     user.String(),
+		Status:       appealStatusNew,
+		CreatedAt:    time.Now(),
+	}
+	if err := dbAddFloodAppeal(&appeal); err != nil {
+		log.Errorf("Unable to add flood appeal for user %s: %s", user.String(), err)
+		return
+	}
+
+	l := userLocale(nil, user)
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(l.T("appeal.button"), fmt.Sprintf("%s:%d", callbackAppeal, appeal.ID)),
+		),
+	)
+	// it works only if user has started the bot before
+	sendMessageWithKeyboard(int64(user.ID), l.T("appeal.offer", appeal.ChatTitle), keyboard)
+}
+
+func floodAppealEvidence(appeal FloodAppeal, l Locale) (text string, err error) {
+	var votes []FloodVote
+	if votes, err = dbGetFloodAppealVotes(appeal.ID); err != nil {
+		return
+	}
+
+	lines := []string{
+		l.T("appeal.evidence", appeal.UserName, appeal.ChatTitle),
+		l.T("appeal.evidence_messages"),
+	}
+	for _, vote := range votes {
+		line := l.T("appeal.evidence_vote", vote.Timestamp.Format("2006-01-02 15:04"), vote.Text, vote.VoterName)
+		if appeal.ChatUserName != "" {
+			line += fmt.Sprintf(" https://t.me/%s/%d", appeal.ChatUserName, vote.MessageID)
+		}
+		lines = append(lines, line)
+	}
+	if len(votes) == 0 {
+		lines = append(lines, l.T("appeal.evidence_no_votes"))
+	}
+
+	text = strings.Join(lines, "\n")
+	return
+}
+
+func callbacksAppealHandler(query *tgbotapi.CallbackQuery, appeal FloodAppeal) {
+	l := userLocale(nil, query.From)
+	if query.From.ID != appeal.UserID {
+		answerCallback(query, l.T("appeal.not_yours"))
+		return
+	}
+	if appeal.Status != appealStatusNew {
+		answerCallback(query, l.T("appeal.sent_already"))
+		return
+	}
+
+	var (
+		admins   []tgbotapi.ChatMember
+		evidence string
+		err      error
+	)
+	if admins, err = bot.GetChatAdministrators(tgbotapi.ChatConfig{ChatID: appeal.ChatID}); err != nil {
+		log.Errorf("Unable to get chat administrators for appeal %d: %s", appeal.ID, err)
+		answerCallback(query, l.T("appeal.admins_error"))
+		return
+	}
+	// administrators get appeal in language of chat
+	adminLocale := chatLocale(appeal.ChatID)
+	if evidence, err = floodAppealEvidence(appeal, adminLocale); err != nil {
+		log.Errorf("Unable to get evidence for appeal %d: %s", appeal.ID, err)
+		answerCallback(query, l.T("appeal.error"))
+		return
+	}
+
+	appeal.Status = appealStatusPending
+	var updated bool
+	if updated, err = dbSetFloodAppealStatus(&appeal, appealStatusNew); err != nil {
+		log.Errorf("Unable to update appeal %d: %s", appeal.ID, err)
+		answerCallback(query, l.T("appeal.error"))
+		return
+	} else if !updated {
+		answerCallback(query, l.T("appeal.sent_already"))
+		return
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(adminLocale.T("appeal.accept"), fmt.Sprintf("%s:%d", callbackAppealAccept, appeal.ID)),
+			tgbotapi.NewInlineKeyboardButtonData(adminLocale.T("appeal.reject"), fmt.Sprintf("%s:%d", callbackAppealReject, appeal.ID)),
+		),
+	)
+	for _, admin := range admins {
+		if admin.User.IsBot {
+			continue
+		}
+		go sendMessageWithKeyboard(int64(admin.User.ID), evidence, keyboard)
+	}
+
+	answerCallback(query, l.T("appeal.sent"))
+	editCallbackMessage(query, l.T("appeal.sent_wait"))
+}
+
+func callbacksAppealResolveHandler(query *tgbotapi.CallbackQuery, appeal FloodAppeal, accept bool) {
+	l := chatLocale(appeal.ChatID)
+	if !userHasRole(&tgbotapi.Chat{ID: appeal.ChatID}, query.From, RoleChatModerator) {
+		answerCallback(query, userLocale(nil, query.From).T("common.forbidden"))
+		return
+	}
+	if appeal.Status != appealStatusPending {
+		answerCallback(query, l.T("appeal.resolved_already", floodAppealStatusString(l, appeal.Status)))
+		return
+	}
+
+	// appeal is resolved before unban, so only one of administrators pressing buttons at the same time resolves it
+	appeal.Status = appealStatusRejected
+	if accept {
+		appeal.Status = appealStatusAccepted
+	}
+	appeal.ResolvedBy = query.From.ID
+	appeal.ResolvedAt = time.Now()
+	if updated, err := dbSetFloodAppealStatus(&appeal, appealStatusPending); err != nil {
+		log.Errorf("Unable to update appeal %d: %s", appeal.ID, err)
+		answerCallback(query, l.T("appeal.error"))
+		return
+	} else if !updated {
+		if current, err := dbGetFloodAppeal(appeal.ID); err == nil {
+			appeal = current
+		}
+		answerCallback(query, l.T("appeal.resolved_already", floodAppealStatusString(l, appeal.Status)))
+		return
+	}
+
+	if accept {
+		config := tgbotapi.ChatMemberConfig{
+			ChatID:             appeal.ChatID,
+			SuperGroupUsername: appeal.ChatUserName,
+			UserID:             appeal.UserID,
+		}
+		if apiResp, err := bot.UnbanChatMember(config); err != nil {
+			log.Warnf("Unable to unban user ID %d for appeal %d. API response with error: (%d) %s", appeal.UserID, appeal.ID, apiResp.ErrorCode, apiResp.Description)
+			// appeal is returned to administrators
+			appeal.Status = appealStatusPending
+			appeal.ResolvedBy = 0
+			appeal.ResolvedAt = time.Time{}
+			if _, err := dbSetFloodAppealStatus(&appeal, appealStatusAccepted); err != nil {
+				log.Errorf("Unable to update appeal %d: %s", appeal.ID, err)
+			}
+			answerCallback(query, l.T("appeal.unban_error"))
+			return
+		}
+		if err := dbSetFloodLevel(appeal.UserID, 0); err != nil {
+			log.Errorf("Unable to clear flood level for user ID %d: %s", appeal.UserID, err)
+		}
+	}
+	log.Infof("Appeal %d of user %s %s by %s", appeal.ID, appeal.UserName, appeal.Status, query.From.String())
+
+	result := l.T("appeal.result", appeal.UserName, floodAppealStatusString(l, appeal.Status), query.From.String())
+	answerCallback(query, result)
+	editCallbackMessage(query, result)
+
+	appellantLocale := chatLocale(int64(appeal.UserID))
+	if accept {
+		sendMessage(int64(appeal.UserID), appellantLocale.T("appeal.accepted", appeal.ChatTitle), 0)
+	} else {
+		sendMessage(int64(appeal.UserID), appellantLocale.T("appeal.rejected", appeal.ChatTitle), 0)
+	}
+}
+
+func floodAppealStatusString(l Locale, status string) string {
+	switch status {
+	case appealStatusNew:
+		return l.T("appeal.status_new")
+	case appealStatusPending:
+		return l.T("appeal.status_pending")
+	case appealStatusAccepted:
+		return l.T("appeal.status_accepted")
+	case appealStatusRejected:
+		return l.T("appeal.status_rejected")
+	}
+	return status
+}
+
+func answerCallback(query *tgbotapi.CallbackQuery, text string) {
+	if _, err := bot.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, text)); err != nil {
+		log.Errorf("Unable to answer callback query: %s", err)
+	}
+}
+
+func editCallbackMessage(query *tgbotapi.CallbackQuery, text string) {
+	if query.Message == nil {
+		return
+	}
+	if _, err := bot.Send(tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, text)); err != nil {
+		log.Errorf("Unable to edit callback message: %s", err)
+	}
+}
@@ -0,0 +1,251 @@
+// -*- Go -*-
+/* ------------------------------------------------ */
+/* Golang source                                    */
+/* Author: Alexei Panov <me@elemc.name> 			*/
+/* ------------------------------------------------ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+// BlocklistMemory type is a thread-safe in-memory copy of active blocklist entries
+type BlocklistMemory struct {
+	users map[int]bool
+	mutex sync.RWMutex
+}
+
+var (
+	blocklist = BlocklistMemory{users: make(map[int]bool)}
+)
+
+// Has function checks user ID in blocklist
+func (bl *BlocklistMemory) Has(userID int) bool {
+	bl.mutex.RLock()
+	defer bl.mutex.RUnlock()
+	return bl.users[userID]
+}
+
+// Update function reloads blocklist from database
+func (bl *BlocklistMemory) Update() (err error) {
+	var users []BlockedUser
+	if users, err = dbBlocklistGetActive(); err != nil {
+		return
+	}
+
+	bl.Set(users)
+	return
+}
+
+// Set function replaces blocklist with users
+func (bl *BlocklistMemory) Set(users []BlockedUser) {
+	list := make(map[int]bool)
+	for _, user := range users {
+		list[user.UserID] = true
+	}
+
+	bl.mutex.Lock()
+	bl.users = list
+	bl.mutex.Unlock()
+}
+
+func blocklistUpdate() {
+	if options.BlocklistSource == "" {
+		log.Debugf("Blocklist source is not set, skip it")
+		return
+	}
+
+	for {
+		if err := blocklistImport(options.BlocklistSource); err != nil {
+			log.Errorf("Unable to import blocklist from %s: %s", options.BlocklistSource, err)
+		}
+		if err := blocklist.Update(); err != nil {
+			log.Errorf("Unable to update blocklist memory cache: %s", err)
+		}
+
+		if options.BlocklistUpdatePeriod == 0 {
+			return
+		}
+		time.Sleep(options.BlocklistUpdatePeriod)
+	}
+}
+
+// blocklistImport stores blocklist from source in database, stored blocklist is not changed if source is unavailable
+func blocklistImport(source string) (err error) {
+	var users []BlockedUser
+	if users, err = blocklistFetch(source); err != nil {
+		return
+	}
+
+	if err = dbBlocklistImport(users); err != nil {
+		return
+	}
+	log.Debugf("Blocklist imported from %s: %d entries", source, len(users))
+	return
+}
+
+// blocklistFetch reads and parses blocklist from file or URL in JSON or CSV format
+func blocklistFetch(source string) (users []BlockedUser, err error) {
+	var data []byte
+	if data, err = blocklistRead(source); err != nil {
+		return
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	if strings.ToLower(filepath.Ext(source)) == ".json" || bytes.HasPrefix(trimmed, []byte("[")) {
+		return blocklistParseJSON(trimmed)
+	}
+	return blocklistParseCSV(trimmed)
+}
+
+func blocklistRead(source string) (data []byte, err error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return ioutil.ReadFile(source)
+	}
+
+	client := http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(source)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("unexpected status %s", resp.Status)
+		return
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// blocklistParseJSON accepts both a plain list of IDs and a list of objects
+func blocklistParseJSON(data []byte) (users []BlockedUser, err error) {
+	var items []json.RawMessage
+	if err = json.Unmarshal(data, &items); err != nil {
+		return
+	}
+
+	for _, item := range items {
+		var id int
+		if err = json.Unmarshal(item, &id); err == nil {
+			users = append(users, BlockedUser{UserID: id})
+			continue
+		}
+
+		var entry struct {
+			UserID  int    `json:"user_id"`
+			Comment string `json:"comment"`
+		}
+		if err = json.Unmarshal(item, &entry); err != nil {
+			return nil, fmt.Errorf("unable to parse blocklist entry %s: %s", item, err)
+		}
+		if entry.UserID == 0 {
+			log.Warnf("Blocklist entry without user ID: %s", item)
+			continue
+		}
+		users = append(users, BlockedUser{UserID: entry.UserID, Comment: entry.Comment})
+	}
+	return users, nil
+}
+
+// blocklistParseCSV accepts lines in format `user_id[,comment]`, header line is skipped
+func blocklistParseCSV(data []byte) (users []BlockedUser, err error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	for line := 1; ; line++ {
+		var record []string
+		if record, err = reader.Read(); err == io.EOF {
+			return users, nil
+		} else if err != nil {
+			return
+		}
+
+		id, convErr := strconv.Atoi(strings.TrimSpace(record[0]))
+		if convErr != nil {
+			if line == 1 { // header
+				continue
+			}
+			log.Warnf("Blocklist line %d has invalid user ID [%s]", line, record[0])
+			continue
+		}
+
+		user := BlockedUser{UserID: id}
+		if len(record) > 1 {
+			user.Comment = strings.TrimSpace(record[1])
+		}
+		users = append(users, user)
+	}
+}
+
+// blocklistCheckMessage kicks blocklisted sender and new members, returns true if message sender is kicked
+func blocklistCheckMessage(msg *tgbotapi.Message) (kicked bool) {
+	if msg.Chat == nil || (!msg.Chat.IsGroup() && !msg.Chat.IsSuperGroup()) {
+		return false
+	}
+
+	var users []tgbotapi.User
+	if msg.From != nil && blocklist.Has(msg.From.ID) {
+		users = append(users, *msg.From)
+	}
+	if msg.NewChatMembers != nil {
+		for _, member := range *msg.NewChatMembers {
+			if msg.From != nil && member.ID == msg.From.ID {
+				continue
+			}
+			if blocklist.Has(member.ID) {
+				users = append(users, member)
+			}
+		}
+	}
+	if len(users) == 0 {
+		return false
+	}
+
+	if !isMeAdmin(msg.Chat) {
+		log.Warnf("Blocklisted user found in chat %d, but bot is not admin there", msg.Chat.ID)
+		return false
+	}
+
+	for _, user := range users {
+		config := tgbotapi.KickChatMemberConfig{}
+		config.ChatID = msg.Chat.ID
+		config.SuperGroupUsername = msg.Chat.UserName
+		config.UserID = user.ID
+		if apiResp, err := bot.KickChatMember(config); err != nil {
+			log.Warnf("Unable to kick blocklisted user %s. API response with error: (%d) %s", user.String(), apiResp.ErrorCode, apiResp.Description)
+			continue
+		}
+		log.Infof("Blocklisted user %s kicked from chat %d", user.String(), msg.Chat.ID)
+
+		if err := dbBlocklistHit(user.ID); err != nil {
+			log.Errorf("Unable to save blocklist hit for user ID %d: %s", user.ID, err)
+		}
+		if msg.From != nil && user.ID == msg.From.ID {
+			kicked = true
+		}
+	}
+
+	if kicked {
+		if _, err := bot.DeleteMessage(tgbotapi.DeleteMessageConfig{ChatID: msg.Chat.ID, MessageID: msg.MessageID}); err != nil {
+			log.Warnf("Unable to delete message from blocklisted user: %s", err)
+		}
+	}
+	return
+}
@@ -0,0 +1,96 @@
+// -*- Go -*-
+/* ------------------------------------------------ */
+/* Golang source                                    */
+/* Author: Alexei Panov <me@elemc.name> 			*/
+/* ------------------------------------------------ */
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBlocklistFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/list.json":
+			w.Write([]byte(`[1, {"user_id": 2, "comment": "spam"}, {"comment": "no ID"}]`))
+		case "/list.csv":
+			w.Write([]byte("user_id,comment\n3,spam\n# comment\nwrong,line\n4\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		path string
+		want []BlockedUser
+	}{
+		{"/list.json", []BlockedUser{{UserID: 1}, {UserID: 2, Comment: "spam"}}},
+		{"/list.csv", []BlockedUser{{UserID: 3, Comment: "spam"}, {UserID: 4}}},
+	}
+	for _, test := range tests {
+		users, err := blocklistFetch(srv.URL + test.path)
+		if err != nil {
+			t.Errorf("unable to fetch %s: %s", test.path, err)
+			continue
+		}
+		if len(users) != len(test.want) {
+			t.Errorf("%s is parsed to %+v, want %+v", test.path, users, test.want)
+			continue
+		}
+		for i := range users {
+			if users[i].UserID != test.want[i].UserID || users[i].Comment != test.want[i].Comment {
+				t.Errorf("%s is parsed to %+v, want %+v", test.path, users, test.want)
+				break
+			}
+		}
+	}
+}
+
+func TestBlocklistRefresh(t *testing.T) {
+	var (
+		body   = "1\n2\n"
+		status = http.StatusOK
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	list := BlocklistMemory{users: make(map[int]bool)}
+	refresh := func() error {
+		users, err := blocklistFetch(srv.URL)
+		if err == nil {
+			list.Set(users)
+		}
+		return err
+	}
+
+	if err := refresh(); err != nil {
+		t.Fatalf("unable to fetch blocklist: %s", err)
+	}
+	if !list.Has(1) || !list.Has(2) || list.Has(3) {
+		t.Fatalf("blocklist is loaded wrong: %v", list.users)
+	}
+
+	body = "2\n3\n"
+	if err := refresh(); err != nil {
+		t.Fatalf("unable to refresh blocklist: %s", err)
+	}
+	if list.Has(1) || !list.Has(2) || !list.Has(3) {
+		t.Fatalf("blocklist is refreshed wrong: %v", list.users)
+	}
+
+	status, body = http.StatusInternalServerError, "4\n"
+	if err := refresh(); err == nil {
+		t.Fatalf("failed fetch of blocklist returns no error")
+	}
+	if list.Has(1) || !list.Has(2) || !list.Has(3) || list.Has(4) {
+		t.Errorf("blocklist is changed by failed fetch: %v", list.users)
+	}
+}
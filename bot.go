@@ -7,22 +7,35 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"math/rand"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/go-pg/pg"
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/telegram-bot-api.v4"
 )
 
+const (
+	// messageMaxLength is a maximum length of Telegram message text
+	messageMaxLength = 4096
+	// captionMaxLength is a maximum length of Telegram media caption
+	captionMaxLength = 1024
+	// mediaGroupMaxSize is a maximum count of photos in album
+	mediaGroupMaxSize = 10
+)
+
 // PhotoCache is a struct for store thread-safe caches
 type PhotoCache struct {
 	cache map[int]string
@@ -46,6 +59,7 @@ func botServe() (err error) {
 
 	photoCache.cache = make(map[int]string)
 	filesCache.cache = make(map[string]string)
+	dnfProcesses = make(chan struct{}, options.DNFMaxProcesses)
 
 	if bot, err = tgbotapi.NewBotAPI(options.APIKey); err != nil {
 		return
@@ -64,6 +78,10 @@ func botServe() (err error) {
 	}
 
 	for update := range updates {
+		if update.CallbackQuery != nil {
+			go callbacksMainHandler(update.CallbackQuery)
+			continue
+		}
 		if update.Message == nil {
 			continue
 		}
@@ -73,11 +91,21 @@ func botServe() (err error) {
 			}
 		}()
 
+		// Blocklist
+		if blocklistCheckMessage(update.Message) {
+			continue
+		}
+
+		// Slow mode and night mode
+		if chatPoliciesViolated(update.Message) {
+			continue
+		}
+
 		// Insult
 		go insultMessage(update.Message)
 
 		// command handler
-		if update.Message.Command() != "" {
+		if messageCommand(update.Message) != "" {
 			go commandsMainHandler(update.Message)
 		}
 	}
@@ -296,36 +324,111 @@ func updatePhotoCache() {
 	log.Debugf("Finish update photo cache.")
 }
 
+// sendMessage sends plain text, it is escaped for current formatter
 func sendMessage(chatID int64, text string, replyID int) {
+	sendText(chatID, newText().Plain(text), replyID)
+}
+
+// sendText sends formatted text
+func sendText(chatID int64, text *Text, replyID int) {
+	msg := tgbotapi.NewMessage(chatID, text.String())
+	if replyID != 0 {
+		msg.ReplyToMessageID = replyID
+	}
+	sendMessageConfig(msg)
+}
+
+func sendMessageWithKeyboard(chatID int64, text string, keyboard tgbotapi.InlineKeyboardMarkup) {
+	msg := tgbotapi.NewMessage(chatID, formatter.Escape(text))
+	msg.ReplyMarkup = keyboard
+	sendMessageConfig(msg)
+}
+
+func sendMessageConfig(msg tgbotapi.MessageConfig) {
+	sendQueuedMessage(msg, OutgoingPriorityHigh)
+}
+
+// sendQueuedMessage sends formatted message through outgoing queue with priority, long message is split to several parts,
+// reply is attached to the first part and keyboard to the last one
+func sendQueuedMessage(msg tgbotapi.MessageConfig, priority OutgoingPriority) {
+	parts := splitMessage(msg.Text, messageMaxLength, formatter)
+	if len(parts) > 1 {
+		log.Debugf("Message to big, size %d, it is split to %d parts", len(msg.Text), len(parts))
+	}
+	for i, text := range parts {
+		part := msg
+		part.Text = text
+		if i > 0 {
+			part.ReplyToMessageID = 0
+		}
+		if i < len(parts)-1 {
+			part.ReplyMarkup = nil
+		}
+		sendMessagePart(part, priority)
+	}
+}
+
+func sendMessagePart(msg tgbotapi.MessageConfig, priority OutgoingPriority) {
 	var (
 		omsg tgbotapi.Message
 		err  error
 	)
 
-	blockSize := 4096
-	if len(text) > blockSize {
-		log.Debugf("Message to big, size %d, must be cut", len(text))
-		sendMessage(chatID, "* Сообщение слишком большое. Текст будет обрезан! *", replyID)
-		suffix := ""
-		if strings.HasPrefix(text, "```") {
-			blockSize = 4088
-			suffix = "```"
+	msg.ParseMode = formatter.ParseMode()
+	if omsg, err = botSend(msg, msg.ChatID, priority); err != nil {
+		// oops, try to send as plain text
+		log.Warnf("oops, unable to send formatted message [%s]: %s. Try to send as plain text.", msg.Text, err)
+		msg.ParseMode = ""
+		msg.Text = formatter.Strip(msg.Text)
+		if omsg, err = botSend(msg, msg.ChatID, priority); err != nil {
+			log.Errorf("Unable to send message to %d with text [%s] and reply [%d]: %s", msg.ChatID, msg.Text, msg.ReplyToMessageID, err)
+			return
 		}
-		text = text[:blockSize]
-		text += suffix
 	}
 
-	msg := tgbotapi.NewMessage(chatID, text)
-	msg.ParseMode = "Markdown"
-	if replyID != 0 {
-		msg.ReplyToMessageID = replyID
+	if err = saveMessage(&omsg); err != nil {
+		log.Errorf("Unable to save outgoing message: %s", err)
 	}
-	if omsg, err = bot.Send(msg); err != nil {
-		// oops, try to send as plain text
-		log.Warnf("oops, unable to send markdown message [%s]: %s. Try to send as plain text.", text, err)
+}
+
+// sendDocument uploads data as document with file name
+func sendDocument(chatID int64, name string, data []byte, replyID int) (err error) {
+	var omsg tgbotapi.Message
+	doc := tgbotapi.NewDocumentUpload(chatID, tgbotapi.FileBytes{Name: name, Bytes: data})
+	doc.ReplyToMessageID = replyID
+	if omsg, err = botSend(doc, chatID, OutgoingPriorityHigh); err != nil {
+		return
+	}
+	if err = saveMessage(&omsg); err != nil {
+		log.Errorf("Unable to save outgoing message: %s", err)
+	}
+	return nil
+}
+
+// sendOutput sends output of command as code block, output longer than configured size is sent as text document
+func sendOutput(chatID int64, name string, output string, replyID int) {
+	if options.OutgoingDocumentSize > 0 && utf8.RuneCountInString(output) > options.OutgoingDocumentSize {
+		err := sendDocument(chatID, name+".txt", []byte(output), replyID)
+		if err == nil {
+			return
+		}
+		log.Errorf("Unable to send output as document to chat %d, it is sent as text: %s", chatID, err)
+	}
+	sendText(chatID, newText().Pre(output), replyID)
+}
+
+// sendPhoto sends photo by URL with formatted caption, caption is sent as plain text if it is invalid
+func sendPhoto(chatID int64, photoURL string, caption string, silent bool) (err error) {
+	var omsg tgbotapi.Message
+	msg := tgbotapi.NewPhotoShare(chatID, photoURL)
+	msg.Caption = caption
+	msg.DisableNotification = silent
+	msg.ParseMode = formatter.ParseMode()
+	if omsg, err = botSend(msg, chatID, OutgoingPriorityLow); err != nil {
+		log.Warnf("oops, unable to send photo with formatted caption [%s]: %s. Try to send as plain text.", caption, err)
 		msg.ParseMode = ""
-		if omsg, err = bot.Send(msg); err != nil {
-			log.Errorf("Unable to send message to %d with text [%s] and reply [%d]: %s", chatID, text, replyID, err)
+		msg.Caption = formatter.Strip(caption)
+		if omsg, err = botSend(msg, chatID, OutgoingPriorityLow); err != nil {
 			return
 		}
 	}
@@ -333,6 +436,62 @@ func sendMessage(chatID int64, text string, replyID int) {
 	if err = saveMessage(&omsg); err != nil {
 		log.Errorf("Unable to save outgoing message: %s", err)
 	}
+	return nil
+}
+
+// sendMediaGroup sends album of photos by URLs, caption is attached to the first photo
+func sendMediaGroup(chatID int64, photoURLs []string, caption string, silent bool) (err error) {
+	var (
+		data []byte
+		resp tgbotapi.APIResponse
+		msgs []tgbotapi.Message
+	)
+	if len(photoURLs) > mediaGroupMaxSize {
+		photoURLs = photoURLs[:mediaGroupMaxSize]
+	}
+
+	send := func(caption, parseMode string) (tgbotapi.APIResponse, error) {
+		var media []map[string]string
+		for i, photoURL := range photoURLs {
+			item := map[string]string{"type": "photo", "media": photoURL}
+			if i == 0 {
+				item["caption"] = caption
+				if parseMode != "" {
+					item["parse_mode"] = parseMode
+				}
+			}
+			media = append(media, item)
+		}
+		if data, err = json.Marshal(media); err != nil {
+			return tgbotapi.APIResponse{}, err
+		}
+
+		params := url.Values{}
+		params.Set("chat_id", strconv.FormatInt(chatID, 10))
+		params.Set("media", string(data))
+		if silent {
+			params.Set("disable_notification", "true")
+		}
+		return botRequest("sendMediaGroup", params, chatID, OutgoingPriorityLow)
+	}
+
+	if resp, err = send(caption, formatter.ParseMode()); err != nil {
+		log.Warnf("oops, unable to send album with formatted caption [%s]: %s. Try to send as plain text.", caption, err)
+		if resp, err = send(formatter.Strip(caption), ""); err != nil {
+			return
+		}
+	}
+
+	if err = json.Unmarshal(resp.Result, &msgs); err != nil {
+		log.Errorf("Unable to parse sent album: %s", err)
+		return nil
+	}
+	for i := range msgs {
+		if err = saveMessage(&msgs[i]); err != nil {
+			log.Errorf("Unable to save outgoing message: %s", err)
+		}
+	}
+	return nil
 }
 
 func isUserAdmin(chat *tgbotapi.Chat, user *tgbotapi.User) bool {
@@ -371,7 +530,7 @@ func sendMessageToAdmins(msg *tgbotapi.Message) {
 		return
 	}
 
-	link := fmt.Sprintf("Новая жалоба на спам: https://t.me/%s/%d", msg.Chat.UserName, msg.ReplyToMessage.MessageID)
+	link := chatLocale(msg.Chat.ID).T("spam.report", msg.Chat.UserName, msg.ReplyToMessage.MessageID)
 
 	for _, admin := range admins {
 		go sendMessage(int64(admin.User.ID), link, 0)
@@ -391,30 +550,6 @@ func isMeAdmin(chat *tgbotapi.Chat) bool {
 	return isUserAdmin(chat, &me)
 }
 
-func sendMessageToAllChats(text string) {
-	if text == "" {
-		log.Warn("Unable to send empty message to all chats!")
-		return
-	}
-
-	var (
-		chats []tgbotapi.Chat
-		err   error
-	)
-	if chats, err = getChats(); err != nil {
-		log.Errorf("Unable to get all chats in sending message [%s] to all chats: %s", text, err)
-		return
-	}
-
-	for _, chat := range chats {
-		if !chat.IsGroup() && !chat.IsSuperGroup() && !chat.IsChannel() { // skip channels, private and other chats
-			continue
-		}
-
-		go sendMessage(chat.ID, text, 0)
-	}
-}
-
 func insultMessage(msg *tgbotapi.Message) {
 	var (
 		targets []string
@@ -7,89 +7,159 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"os/exec"
+	"strconv"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/telegram-bot-api.v4"
 )
 
+// BotCommand is a type for describe command handler and role required to run it
+type BotCommand struct {
+	Handler func(msg *tgbotapi.Message)
+	Role    Role
+}
+
+var botCommands map[string]BotCommand
+
+func init() {
+	botCommands = map[string]BotCommand{
+		"start":             {commandsStartHandler, RoleMember},
+		"help":              {commandsHelpHandler, RoleMember},
+		"ban":               {commandsBanHandler, RoleChatModerator},
+		"unban":             {commandsBanHandler, RoleChatModerator},
+		"dnf":               {commandsDNFHandler, RoleMember},
+		"yum":               {commandsDNFHandler, RoleMember},
+		"flood":             {commandsFloodHandler, RoleMember},
+		"invert":            {commandsInvertHandler, RoleMember},
+		"ping":              {commandsPingHandler, RoleMember},
+		"pid":               {commandsPIDHandler, RoleMember},
+		"link":              {commandsLinkHandler, RoleMember},
+		"add_feed":          {commandsAddFeed, RoleChatModerator},
+		"del_feed":          {commandsDelFeed, RoleChatModerator},
+		"show_feeds":        {commandsShowFeeds, RoleMember},
+		"feed_interval":     {commandsFeedIntervalHandler, RoleBotAdmin},
+		"feed_category":     {commandsFeedCategoryHandler, RoleBotAdmin},
+		"add_category":      {commandsAddCategoryHandler, RoleChatModerator},
+		"del_category":      {commandsDelCategoryHandler, RoleChatModerator},
+		"feed_filter":       {commandsFeedFilterHandler, RoleChatModerator},
+		"feed_status":       {commandsFeedStatusHandler, RoleMember},
+		"feed_template":     {commandsFeedTemplateHandler, RoleChatModerator},
+		"feed_mode":         {commandsFeedModeHandler, RoleChatModerator},
+		"feed_notify":       {commandsFeedNotifyHandler, RoleChatModerator},
+		"preview_feed":      {commandsPreviewFeedHandler, RoleMember},
+		"quiet_hours":       {commandsQuietHoursHandler, RoleChatModerator},
+		"feed_enable":       {commandsFeedEnableHandler, RoleChatModerator},
+		"export_feeds":      {commandsExportFeedsHandler, RoleMember},
+		"import_feeds":      {commandsImportFeedsHandler, RoleChatModerator},
+		"add_insult_word":   {func(msg *tgbotapi.Message) { commandsAddInsult(msg, true) }, RoleBotAdmin},
+		"add_insult_target": {func(msg *tgbotapi.Message) { commandsAddInsult(msg, false) }, RoleBotAdmin},
+		"del_insult_word":   {func(msg *tgbotapi.Message) { commandsDelInsult(msg, true) }, RoleBotAdmin},
+		"del_insult_target": {func(msg *tgbotapi.Message) { commandsDelInsult(msg, false) }, RoleBotAdmin},
+		"show_insult":       {commandsShowInsult, RoleMember},
+		"slow_mode":         {commandsSlowModeHandler, RoleChatModerator},
+		"night_mode":        {commandsNightModeHandler, RoleChatModerator},
+		"timezone":          {commandsTimezoneHandler, RoleChatModerator},
+		"lang":              {commandsLangHandler, RoleMember},
+		"grant":             {func(msg *tgbotapi.Message) { commandsRoleHandler(msg, true) }, RoleChatModerator},
+		"revoke":            {func(msg *tgbotapi.Message) { commandsRoleHandler(msg, false) }, RoleChatModerator},
+		"roles":             {commandsShowRolesHandler, RoleMember},
+	}
+}
+
+// messageCommand returns command of message, command in caption of document is used too
+func messageCommand(msg *tgbotapi.Message) string {
+	if cmd := msg.Command(); cmd != "" {
+		return cmd
+	}
+	if msg.Document == nil || !strings.HasPrefix(msg.Caption, "/") {
+		return ""
+	}
+	cmd := strings.Fields(msg.Caption)[0][1:]
+	if i := strings.Index(cmd, "@"); i >= 0 {
+		cmd = cmd[:i]
+	}
+	return cmd
+}
+
 func commandsMainHandler(msg *tgbotapi.Message) {
-	cmd := msg.Command()
+	cmd := strings.ToLower(messageCommand(msg))
 	args := msg.CommandArguments()
 	log.Debugf("Command from %s: `%s %s`", msg.From.String(), cmd, args)
-	switch strings.ToLower(cmd) {
-	case "start":
-		go commandsStartHandler(msg)
-	case "ban", "unban":
-		go commandsBanHandler(msg)
-	case "dnf", "yum":
-		go commandsDNFHandler(msg)
-	case "flood":
-		go commandsFloodHandler(msg)
-	case "invert":
-		go commandsInvertHandler(msg)
-	case "ping":
-		go commandsPingHandler(msg)
-	case "help":
-		go commandsHelpHandler(msg)
-	case "pid":
-		go commandsPIDHandler(msg)
-	case "link":
-		go commandsLinkHandler(msg)
-	case "add_feed":
-		go commandsAddFeed(msg)
-	case "del_feed":
-		go commandsDelFeed(msg)
-	case "show_feeds":
-		go commandsShowFeeds(msg)
-	case "add_insult_word":
-		go commandsAddInsult(msg, true)
-	case "add_insult_target":
-		go commandsAddInsult(msg, false)
-	case "del_insult_word":
-		go commandsDelInsult(msg, true)
-	case "del_insult_target":
-		go commandsDelInsult(msg, false)
-	case "show_insult":
-		go commandsShowInsult(msg)
+
+	command, ok := botCommands[cmd]
+	if !ok {
+		return
+	}
+	if !userHasRole(msg.Chat, msg.From, command.Role) {
+		sendMessage(msg.Chat.ID, tr(msg, "common.forbidden"), msg.MessageID)
+		log.Debugf("Command `%s` from %s without role %s", cmd, msg.From.String(), command.Role)
+		return
+	}
+	if !commandsCooldownAllowed(msg, cmd) {
+		return
+	}
+	go command.Handler(msg)
+}
+
+func callbacksMainHandler(query *tgbotapi.CallbackQuery) {
+	log.Debugf("Callback from %s: `%s`", query.From.String(), query.Data)
+	parts := strings.SplitN(query.Data, ":", 2)
+	if len(parts) != 2 {
+		answerCallback(query, "")
+		return
+	}
+
+	switch parts[0] {
+	case callbackAppeal, callbackAppealAccept, callbackAppealReject:
+		var (
+			id     int64
+			appeal FloodAppeal
+			err    error
+		)
+		if id, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+			log.Warnf("Invalid appeal ID in callback data [%s]", query.Data)
+			answerCallback(query, "")
+			return
+		}
+		if appeal, err = dbGetFloodAppeal(id); err != nil {
+			log.Errorf("Unable to get appeal %d: %s", id, err)
+			answerCallback(query, userLocale(nil, query.From).T("appeal.not_found"))
+			return
+		}
+
+		if parts[0] == callbackAppeal {
+			callbacksAppealHandler(query, appeal)
+		} else {
+			callbacksAppealResolveHandler(query, appeal, parts[0] == callbackAppealAccept)
+		}
 	default:
+		answerCallback(query, "")
 	}
 }
 
 func commandsStartHandler(msg *tgbotapi.Message) {
-	t := fmt.Sprintf("Привет %s!", msg.From.String())
+	t := tr(msg, "start.hello", msg.From.String())
 	sendMessage(msg.Chat.ID, t, msg.MessageID)
 	log.Debugf("Say hello to %s", msg.From.String())
 }
 
 func commandsHelpHandler(msg *tgbotapi.Message) {
-	helpMsg :=
-		`Помощь по командам бота.
-/start - приветствие (стандартная для любого бота Telegram)
-/help - данная справка
-/ban @username - забанить пользователя в группе (бот должен иметь административные права в группе)
-/unban @username - разбанить пользователя в группе (бот должен иметь административные права в группе)
-/ping - шуточный пинг
-/yum [info provides repolist repoquery] - аналог системной команды
-/dnf [info provides repolist repoquery] - аналог системной команды
-/pid - в ответ на сообщение возвращает его ID
-/link - в ответ на сообщение возвращает ссылку, если чат публичный
-/flood - в ответ на сообщение меняет уровень флудера для пользователя
-/invert - в ответ на сообщение транслитерирует исходное сообщение в новом
-`
-	sendMessage(msg.Chat.ID, helpMsg, 0)
+	sendMessage(msg.Chat.ID, tr(msg, "help"), 0)
 }
 
 func commandsLinkHandler(msg *tgbotapi.Message) {
 	if msg.ReplyToMessage == nil {
-		sendMessage(msg.Chat.ID, "Напиши команду в ответ на сообщение, тогда сработает.", msg.MessageID)
+		sendMessage(msg.Chat.ID, tr(msg, "common.reply_required"), msg.MessageID)
 		return
 	}
 	if len(msg.Chat.UserName) == 0 {
-		sendMessage(msg.Chat.ID, fmt.Sprintf("Это не публичный чат, ссылку получить невозможно. Message ID = *%d*", msg.ReplyToMessage.MessageID), msg.MessageID)
+		sendText(msg.Chat.ID, newText().Plain(tr(msg, "link.private")).Bold(strconv.Itoa(msg.ReplyToMessage.MessageID)), msg.MessageID)
 		return
 	}
 
@@ -98,11 +168,11 @@ func commandsLinkHandler(msg *tgbotapi.Message) {
 
 func commandsPIDHandler(msg *tgbotapi.Message) {
 	if msg.ReplyToMessage == nil {
-		sendMessage(msg.Chat.ID, "Напиши команду в ответ на сообщение, тогда сработает.", msg.MessageID)
+		sendMessage(msg.Chat.ID, tr(msg, "common.reply_required"), msg.MessageID)
 		return
 	}
 
-	sendMessage(msg.Chat.ID, fmt.Sprintf("``` %d ```", msg.ReplyToMessage.MessageID), msg.MessageID)
+	sendText(msg.Chat.ID, newText().Code(strconv.Itoa(msg.ReplyToMessage.MessageID)), msg.MessageID)
 }
 
 func commandsPingHandler(msg *tgbotapi.Message) {
@@ -110,16 +180,16 @@ func commandsPingHandler(msg *tgbotapi.Message) {
 	r.Seed(int64(msg.MessageID))
 
 	if r.Int()%12 == 0 {
-		sendMessage(msg.Chat.ID, "Request timed out 😜", msg.MessageID)
+		sendMessage(msg.Chat.ID, tr(msg, "ping.timeout"), msg.MessageID)
 		return
 	}
-	pingMsg := fmt.Sprintf("%s пинг от тебя %3.3f 😜", msg.From.String(), r.Float32())
+	pingMsg := tr(msg, "ping.reply", msg.From.String(), r.Float32())
 	sendMessage(msg.Chat.ID, pingMsg, msg.MessageID)
 }
 
 func commandsFloodHandler(msg *tgbotapi.Message) {
 	if msg.ReplyToMessage == nil {
-		sendMessage(msg.Chat.ID, "Напиши команду в ответ на сообщение-флуд, тогда сработает.", msg.MessageID)
+		sendMessage(msg.Chat.ID, tr(msg, "flood.reply_required"), msg.MessageID)
 		return
 	}
 
@@ -127,13 +197,13 @@ func commandsFloodHandler(msg *tgbotapi.Message) {
 		log.Errorf("Unable to get bot user: %s", err)
 		return
 	} else if botUser.ID == msg.ReplyToMessage.From.ID {
-		sendMessage(msg.Chat.ID, fmt.Sprintf("Хорошая попытка %s 😜", msg.From.String()), msg.MessageID)
+		sendMessage(msg.Chat.ID, tr(msg, "flood.bot", msg.From.String()), msg.MessageID)
 		return
 	}
 
 	// check himself
 	if msg.ReplyToMessage.From.ID == msg.From.ID {
-		sendMessage(msg.Chat.ID, "Самотык? 😜", msg.MessageID)
+		sendMessage(msg.Chat.ID, tr(msg, "flood.self"), msg.MessageID)
 		return
 	}
 
@@ -142,7 +212,7 @@ func commandsFloodHandler(msg *tgbotapi.Message) {
 		log.Errorf("Unable to get cache: %s", err)
 		return
 	} else if exists {
-		sendMessage(msg.Chat.ID, fmt.Sprintf("Ты недавно уже объявлял %s флудером. Подожди некоторое время: %s", msg.ReplyToMessage.From.String(), (options.CacheDuration-d).String()), msg.MessageID)
+		sendMessage(msg.Chat.ID, tr(msg, "flood.recent", msg.ReplyToMessage.From.String(), durationString(options.CacheDuration-d)), msg.MessageID)
 		return
 	} else {
 		if err = cacheSet(msg.ReplyToMessage.From.ID, msg.From.ID); err != nil {
@@ -161,6 +231,19 @@ func commandsFloodHandler(msg *tgbotapi.Message) {
 		apiResp tgbotapi.APIResponse
 	)
 
+	vote := FloodVote{
+		ChatID:    msg.Chat.ID,
+		FlooderID: msg.ReplyToMessage.From.ID,
+		VoterID:   msg.From.ID,
+		VoterName: msg.From.String(),
+		MessageID: msg.ReplyToMessage.MessageID,
+		Text:      msg.ReplyToMessage.Text,
+		Timestamp: time.Now(),
+	}
+	if err = dbAddFloodVote(vote); err != nil {
+		log.Errorf("Unable to save flood vote for %d: %s", msg.ReplyToMessage.From.ID, err)
+	}
+
 	if level, err = dbAddFloodLevel(msg.ReplyToMessage.From.ID); err != nil {
 		log.Errorf("Unable to add flood level for %d: %s", msg.ReplyToMessage.From.ID, err)
 		return
@@ -171,24 +254,23 @@ func commandsFloodHandler(msg *tgbotapi.Message) {
 		config.SuperGroupUsername = msg.Chat.UserName
 		config.UserID = msg.ReplyToMessage.From.ID
 		if apiResp, err = bot.KickChatMember(config); err != nil {
-			if apiResp.Ok {
-				sendMessage(msg.Chat.ID, fmt.Sprintf("%s терпение туземцев этого чата по поводу твоего флуда кончилось. Мы изгоняем тебя!", msg.ReplyToMessage.From.String()), 0)
-			} else {
-				log.Warnf("Unable to ban flooder %s. API response with error: (%d) %s", msg.ReplyToMessage.From.String(), apiResp.ErrorCode, apiResp.Description)
-			}
+			log.Warnf("Unable to ban flooder %s. API response with error: (%d) %s", msg.ReplyToMessage.From.String(), apiResp.ErrorCode, apiResp.Description)
+		} else {
+			sendText(msg.Chat.ID, newText().Mention(msg.ReplyToMessage.From.String(), msg.ReplyToMessage.From.ID).Plain(tr(msg, "flood.banned")), 0)
+			go floodAppealOffer(msg.Chat, msg.ReplyToMessage.From)
 		}
 
 		if err = dbSetFloodLevel(msg.ReplyToMessage.From.ID, 0); err != nil {
 			log.Errorf("Unable to clear flood level for banned user: %s", err)
 		}
 	} else {
-		sendMessage(msg.Chat.ID, fmt.Sprintf("%s тебя назвали флудером, осталось попыток %d и будешь изгнан!", msg.ReplyToMessage.From.String(), options.MaximumFloodLevel-level), msg.ReplyToMessage.MessageID)
+		sendText(msg.Chat.ID, newText().Mention(msg.ReplyToMessage.From.String(), msg.ReplyToMessage.From.ID).Plain(msgLocale(msg).N("flood.warning", options.MaximumFloodLevel-level, options.MaximumFloodLevel-level)), msg.ReplyToMessage.MessageID)
 	}
 }
 
 func commandsInvertHandler(msg *tgbotapi.Message) {
 	if msg.ReplyToMessage == nil {
-		sendMessage(msg.Chat.ID, "Напиши команду в ответ на сообщение, тогда сработает.", msg.MessageID)
+		sendMessage(msg.Chat.ID, tr(msg, "common.reply_required"), msg.MessageID)
 		return
 	}
 
@@ -196,7 +278,7 @@ func commandsInvertHandler(msg *tgbotapi.Message) {
 		log.Errorf("Unable to get bot user: %s", err)
 		return
 	} else if botUser.ID == msg.ReplyToMessage.From.ID {
-		sendMessage(msg.Chat.ID, fmt.Sprintf("Хорошая попытка, %s 😜", msg.From.String()), msg.MessageID)
+		sendMessage(msg.Chat.ID, tr(msg, "invert.bot", msg.From.String()), msg.MessageID)
 		return
 	}
 
@@ -230,39 +312,33 @@ func commandsInvertHandler(msg *tgbotapi.Message) {
 				}
 			}
 		}
-		answer := fmt.Sprintf("Возможно %s пытался сказать:\n", msg.ReplyToMessage.From.String())
+		answer := tr(msg, "invert.answer", msg.ReplyToMessage.From.String())
 		answer += strings.Join(translit, " ")
 		sendMessage(msg.Chat.ID, answer, msg.ReplyToMessage.MessageID)
 		return
 	} else {
-		sendMessage(msg.Chat.ID, fmt.Sprintf("%s, ты можешь транслитерировать только свои сообщения.", msg.From.String()), msg.MessageID)
+		sendMessage(msg.Chat.ID, tr(msg, "invert.own_only", msg.From.String()), msg.MessageID)
 		return
 	}
 }
 
 func commandsBanHandler(msg *tgbotapi.Message) {
 	if !msg.Chat.IsGroup() && !msg.Chat.IsSuperGroup() {
-		sendMessage(msg.Chat.ID, "Кого будем банить в привате? 😂", msg.MessageID)
+		sendMessage(msg.Chat.ID, tr(msg, "ban.private"), msg.MessageID)
 		log.Debugf("Commands `ban` or `unban` in private chat from %s", msg.From.String())
 		return
 	}
 
 	if !isMeAdmin(msg.Chat) {
-		sendMessage(msg.Chat.ID, "Бот не является администратором этого чата. Команда недоступна!", msg.MessageID)
+		sendMessage(msg.Chat.ID, tr(msg, "ban.not_admin"), msg.MessageID)
 		log.Warn("Commands `ban` or `unban` in chat with bot not admin from %s", msg.From.String())
 		return
 	}
 
 	log.Debugf("Commands `ban` or `unban` in group or supergroup chat with bot admin from %s", msg.From.String())
 
-	if !isUserAdmin(msg.Chat, msg.From) {
-		sendMessage(msg.Chat.ID, "Ты не админ в этом чате! Не имеешь право на баны/разбаны! 🤔\nПопытка управления реальностью записана в анналы, группа немедленного БАНения уже выехала за тобой!😉", msg.MessageID)
-		log.Warnf("Commands `ban` or `unban` run fails, user %s not admin in chat!", msg.From.String())
-		return
-	}
-
 	if msg.CommandArguments() == "" {
-		sendMessage(msg.Chat.ID, "Кого будем банить?", msg.MessageID)
+		sendMessage(msg.Chat.ID, tr(msg, "ban.whom"), msg.MessageID)
 		log.Debugf("Command `ban` without arguments from %s", msg.From.String())
 		return
 	}
@@ -275,10 +351,10 @@ func commandsBanHandler(msg *tgbotapi.Message) {
 	)
 	if user, err = getUser(username); err != nil {
 		if err == ErrorUserNotFound {
-			sendMessage(msg.Chat.ID, fmt.Sprintf("Не нашли пользователя %s", username), msg.MessageID)
+			sendMessage(msg.Chat.ID, tr(msg, "user.not_found", username), msg.MessageID)
 			return
 		} else if strings.Contains(err.Error(), "Список:") {
-			sendMessage(msg.Chat.ID, fmt.Sprintf("Более одного пользователя попало в выборку. Попробуй с @username. \n%s", err), msg.MessageID)
+			sendMessage(msg.Chat.ID, tr(msg, "user.ambiguous", err), msg.MessageID)
 			return
 		}
 		log.Errorf("Unable to find user with name [%s]: %s", username, err)
@@ -302,15 +378,18 @@ func commandsBanHandler(msg *tgbotapi.Message) {
 
 	if err != nil {
 		if apiResp.Ok || apiResp.ErrorCode == 0 {
-			sendMessage(msg.Chat.ID, "Сделано", msg.MessageID)
+			sendMessage(msg.Chat.ID, tr(msg, "common.done"), msg.MessageID)
 			log.Debugf("Ban/Unban %s successful", user.String())
 		} else {
-			sendMessage(msg.Chat.ID, fmt.Sprintf("*Ошибка*: ``` код=%d, описание=%s ```", apiResp.ErrorCode, apiResp.Description), msg.MessageID)
+			sendText(msg.Chat.ID, newText().Bold(tr(msg, "ban.error")).Plain(": ").Code(tr(msg, "ban.error_details", apiResp.ErrorCode, apiResp.Description)), msg.MessageID)
 			log.Warnf("API response with error: (%d) %s", apiResp.ErrorCode, apiResp.Description)
 		}
 	}
 }
 
+// dnfProcesses limits number of running dnf processes
+var dnfProcesses chan struct{}
+
 func commandsDNFHandler(msg *tgbotapi.Message) {
 	var (
 		err    error
@@ -331,7 +410,7 @@ func commandsDNFHandler(msg *tgbotapi.Message) {
 
 	args := strings.Replace(msg.CommandArguments(), "—", "--", -1)
 	if args == "" {
-		sendMessage(msg.Chat.ID, "Не знаю, что выполнять, ты же ничего не указал в аргументах", msg.MessageID)
+		sendMessage(msg.Chat.ID, tr(msg, "dnf.no_args"), msg.MessageID)
 		log.Debugf("Command `dnf` without arguments from %s", msg.From.String())
 		return
 	}
@@ -342,85 +421,665 @@ func commandsDNFHandler(msg *tgbotapi.Message) {
 		if _, ok := appendQ[arglist[0]]; ok == true {
 			arglist = append(arglist, "-q")
 		}
+		select {
+		case dnfProcesses <- struct{}{}:
+			defer func() { <-dnfProcesses }()
+		default:
+			sendMessage(msg.Chat.ID, tr(msg, "dnf.busy"), msg.MessageID)
+			log.Debugf("Command `dnf` from %s rejected, too many running processes", msg.From.String())
+			return
+		}
+
 		cmd := exec.Command("/usr/bin/dnf", arglist...)
 		if output, err = cmd.CombinedOutput(); err != nil {
 			log.Errorf("Unable to run command form %s: dnf %s: %s", msg.From.String(), strings.Join(arglist, " "), strings.Join(arglist, " "))
-			sendMessage(msg.Chat.ID, "Ой. Что-то пошло не так!", msg.MessageID)
+			sendMessage(msg.Chat.ID, tr(msg, "common.error"), msg.MessageID)
 		} else if len(output) == 0 {
-			sendMessage(msg.Chat.ID, "А нечего выводить, вывод пустой", msg.MessageID)
+			sendMessage(msg.Chat.ID, tr(msg, "dnf.empty"), msg.MessageID)
 			log.Warnf("Run command from %s: dnf %s with empty output", msg.From.String(), strings.Join(arglist, " "))
 		} else {
-			sendMessage(msg.Chat.ID, fmt.Sprintf("``` %s ```", output), msg.MessageID)
+			sendOutput(msg.Chat.ID, "dnf", string(output), msg.MessageID)
 			log.Debugf("Run command from %s: dnf %s", msg.From.String(), strings.Join(arglist, " "))
 		}
 	} else {
-		sendMessage(msg.Chat.ID, fmt.Sprintf("Неизвестная подкомманда: %s", arglist[0]), msg.MessageID)
+		sendMessage(msg.Chat.ID, tr(msg, "common.unknown_subcommand", arglist[0]), msg.MessageID)
 		log.Debugf("Unknown `dnf` subcommand: %s", msg.From.String())
 		return
 	}
 }
 
 func commandsAddFeed(msg *tgbotapi.Message) {
-	if msg.CommandArguments() == "" {
-		sendMessage(msg.Chat.ID, "Задай аргумент - ссылку на RSS/ATOM", msg.MessageID)
+	var (
+		url  string
+		last int
+		err  error
+	)
+	args := strings.Fields(msg.CommandArguments())
+	for i := 0; i < len(args); i++ {
+		if args[i] != "--last" {
+			url = args[i]
+			continue
+		}
+		if i+1 >= len(args) {
+			last = -1
+			break
+		}
+		i++
+		if last, err = strconv.Atoi(args[i]); err != nil {
+			last = -1
+		}
+	}
+	if url == "" {
+		sendMessage(msg.Chat.ID, tr(msg, "feed.url_required"), msg.MessageID)
 		log.Debugf("Command add_pulse without arguments from %s", msg.From.String())
 		return
 	}
+	if last < 0 {
+		sendMessage(msg.Chat.ID, tr(msg, "feed.last_required"), msg.MessageID)
+		return
+	}
 
-	if err := feedAdd(msg.CommandArguments()); err != nil {
-		log.Warnf("Unable to add feed [%s]: %s", msg.CommandArguments(), err)
-		sendMessage(msg.Chat.ID, "Что-то пошло не так, может ты с URL накосячил?", msg.MessageID)
+	if err = feedAdd(url, msg.Chat.ID, msg.From.ID, last); err != nil && err != ErrorSubscriptionAlreadyExists {
+		log.Warnf("Unable to add feed [%s]: %s", url, err)
+		sendMessage(msg.Chat.ID, tr(msg, "feed.add_error", err, url), msg.MessageID)
+		return
+	} else if err == ErrorSubscriptionAlreadyExists {
+		sendMessage(msg.Chat.ID, tr(msg, "feed.exists"), msg.MessageID)
 		return
 	}
 
-	sendMessage(msg.Chat.ID, "Добавил источник в пульс.", msg.MessageID)
+	sendMessage(msg.Chat.ID, tr(msg, "feed.added"), msg.MessageID)
 }
 
 func commandsDelFeed(msg *tgbotapi.Message) {
 	if msg.CommandArguments() == "" {
-		sendMessage(msg.Chat.ID, "Задай аргумент - ссылку на RSS/ATOM", msg.MessageID)
+		sendMessage(msg.Chat.ID, tr(msg, "feed.url_required"), msg.MessageID)
 		log.Debugf("Command del_pulse without arguments from %s", msg.From.String())
 		return
 	}
 
-	if err := feedDel(msg.CommandArguments()); err != nil && err != ErrorFeedNotFound {
-		log.Warnf("Unable to add feed [%s]: %s", msg.CommandArguments(), err)
-		sendMessage(msg.Chat.ID, "Что-то пошло не так, может ты с URL накосячил?", msg.MessageID)
+	if err := feedDel(msg.CommandArguments(), msg.Chat.ID); err != nil && err != ErrorSubscriptionNotFound {
+		log.Warnf("Unable to delete feed [%s]: %s", msg.CommandArguments(), err)
+		sendMessage(msg.Chat.ID, tr(msg, "feed.del_error"), msg.MessageID)
 		return
-	} else if err == ErrorFeedNotFound {
-		sendMessage(msg.Chat.ID, "Такого источника у меня не записано. Нечего удалять.", msg.MessageID)
+	} else if err == ErrorSubscriptionNotFound {
+		sendMessage(msg.Chat.ID, tr(msg, "feed.del_not_found"), msg.MessageID)
 		return
 	}
 
-	sendMessage(msg.Chat.ID, "Удалил источник из пульса.", msg.MessageID)
+	sendMessage(msg.Chat.ID, tr(msg, "feed.deleted"), msg.MessageID)
 }
 
 func commandsShowFeeds(msg *tgbotapi.Message) {
 	var (
 		feeds []Feeder
 		err   error
-		urls  []string
 	)
-	if feeds, err = dbGetAllFeeds(); err != nil {
-		log.Errorf("Unable to get all feeds from database: %s", err)
+	if feeds, err = dbGetChatFeeds(msg.Chat.ID); err != nil {
+		log.Errorf("Unable to get feeds of chat %d from database: %s", msg.Chat.ID, err)
+		return
+	}
+	if len(feeds) == 0 {
+		sendMessage(msg.Chat.ID, tr(msg, "feeds.empty"), 0)
+		return
+	}
+
+	categories, groups := feedsByCategory(feeds)
+	if args := strings.TrimSpace(msg.CommandArguments()); args != "" {
+		category, _ := feedCategoryName(args)
+		if len(groups[category]) == 0 {
+			sendMessage(msg.Chat.ID, tr(msg, "feeds.category_empty"), 0)
+			return
+		}
+		categories = []string{category}
+	}
+
+	text := newText().Plain(tr(msg, "feeds.title"))
+	for _, category := range categories {
+		title := category
+		if title == "" {
+			title = tr(msg, "feeds.uncategorized")
+		}
+		text.Line().Bold(title).Plain(":")
+		for _, feed := range groups[category] {
+			text.Line().Link(feed.Name, feed.URL)
+		}
+	}
+
+	if subs, err := dbGetChatCategorySubscriptions(msg.Chat.ID); err != nil {
+		log.Errorf("Unable to get category subscriptions of chat %d: %s", msg.Chat.ID, err)
+	} else if len(subs) > 0 {
+		var names []string
+		for _, sub := range subs {
+			names = append(names, sub.Category)
+		}
+		text.Line().Plain(tr(msg, "feeds.categories", strings.Join(names, ", ")))
+	}
+
+	sendText(msg.Chat.ID, text, 0)
+}
+
+func commandsFeedCategoryHandler(msg *tgbotapi.Message) {
+	args := strings.Fields(msg.CommandArguments())
+	if len(args) == 0 {
+		sendMessage(msg.Chat.ID, tr(msg, "category.args_required"), msg.MessageID)
+		return
+	}
+
+	feed, err := dbGetFeed(args[0])
+	if err != nil {
+		sendMessage(msg.Chat.ID, tr(msg, "feed.unknown"), msg.MessageID)
+		log.Debugf("Unable to get feed %s: %s", args[0], err)
+		return
+	}
+	if len(args) == 1 {
+		if len(feed.Categories) == 0 {
+			sendMessage(msg.Chat.ID, tr(msg, "category.none"), msg.MessageID)
+			return
+		}
+		sendMessage(msg.Chat.ID, tr(msg, "category.list", strings.Join(feed.Categories, ", ")), msg.MessageID)
+		return
+	}
+	if len(args) < 3 || (args[1] != "add" && args[1] != "del") {
+		sendMessage(msg.Chat.ID, tr(msg, "category.args_required"), msg.MessageID)
+		return
+	}
+
+	category, err := feedCategoryName(args[2])
+	if err != nil {
+		sendMessage(msg.Chat.ID, tr(msg, "category.one_word"), msg.MessageID)
+		return
+	}
+	if args[1] == "add" {
+		err = feedCategoryAdd(feed.URL, category)
+	} else {
+		err = feedCategoryDel(feed.URL, category)
+	}
+	if err != nil {
+		log.Errorf("Unable to change category %s of feed %s: %s", category, feed.URL, err)
+		sendMessage(msg.Chat.ID, tr(msg, "common.error"), msg.MessageID)
+		return
+	}
+	sendMessage(msg.Chat.ID, tr(msg, "common.done"), msg.MessageID)
+}
+
+func commandsAddCategoryHandler(msg *tgbotapi.Message) {
+	category, err := feedCategoryName(msg.CommandArguments())
+	if err != nil {
+		sendMessage(msg.Chat.ID, tr(msg, "category.arg_required"), msg.MessageID)
+		return
+	}
+
+	count, err := categorySubscribe(category, msg.Chat.ID, msg.From.ID)
+	if err == ErrorFeedNotFound {
+		sendMessage(msg.Chat.ID, tr(msg, "category.no_feeds"), msg.MessageID)
+		return
+	} else if err == ErrorSubscriptionAlreadyExists {
+		sendMessage(msg.Chat.ID, tr(msg, "category.subscribed_already"), msg.MessageID)
+		return
+	} else if err != nil {
+		log.Errorf("Unable to subscribe chat %d to category %s: %s", msg.Chat.ID, category, err)
+		sendMessage(msg.Chat.ID, tr(msg, "common.error"), msg.MessageID)
+		return
+	}
+	sendMessage(msg.Chat.ID, msgLocale(msg).N("category.subscribed", count, count), msg.MessageID)
+}
+
+func commandsDelCategoryHandler(msg *tgbotapi.Message) {
+	category, err := feedCategoryName(msg.CommandArguments())
+	if err != nil {
+		sendMessage(msg.Chat.ID, tr(msg, "category.arg_required"), msg.MessageID)
+		return
+	}
+
+	if err = categoryUnsubscribe(category, msg.Chat.ID); err == ErrorSubscriptionNotFound {
+		sendMessage(msg.Chat.ID, tr(msg, "category.not_subscribed"), msg.MessageID)
+		return
+	} else if err != nil {
+		log.Errorf("Unable to unsubscribe chat %d from category %s: %s", msg.Chat.ID, category, err)
+		sendMessage(msg.Chat.ID, tr(msg, "common.error"), msg.MessageID)
+		return
+	}
+	sendMessage(msg.Chat.ID, tr(msg, "category.unsubscribed"), msg.MessageID)
+}
+
+func commandsPreviewFeedHandler(msg *tgbotapi.Message) {
+	url := strings.TrimSpace(msg.CommandArguments())
+	if url == "" {
+		sendMessage(msg.Chat.ID, tr(msg, "preview.url_required"), msg.MessageID)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), options.FeedsDeadline)
+	defer cancel()
+	fd, feedURL, err := feedDiscover(ctx, url)
+	if err == nil && fd == nil {
+		err = fmt.Errorf("unexpected not modified answer")
+	}
+	if err != nil {
+		sendMessage(msg.Chat.ID, tr(msg, "preview.error", url, err), msg.MessageID)
+		return
+	}
+
+	text := newText().Bold(fd.Title).Line().
+		Plain(tr(msg, "preview.type", strings.ToUpper(fd.FeedType), fd.FeedVersion)).Line().
+		Plain(msgLocale(msg).N("preview.news", len(fd.Items), len(fd.Items)))
+	if feedURL != url {
+		text.Line().Plain(tr(msg, "preview.found", feedURL))
+	}
+	text.Line().Plain(tr(msg, "preview.add", feedURL))
+	sendText(msg.Chat.ID, text, msg.MessageID)
+
+	feedSendLast(fd, feedURL, msg.Chat.ID, 3)
+}
+
+func commandsFeedIntervalHandler(msg *tgbotapi.Message) {
+	args := strings.Fields(msg.CommandArguments())
+	if len(args) == 0 {
+		sendMessage(msg.Chat.ID, tr(msg, "interval.args_required"), msg.MessageID)
+		return
+	}
+
+	feed, err := dbGetFeed(args[0])
+	if err != nil {
+		sendMessage(msg.Chat.ID, tr(msg, "feed.unknown"), msg.MessageID)
+		log.Debugf("Unable to get feed %s: %s", args[0], err)
+		return
+	}
+	if len(args) == 1 {
+		sendMessage(msg.Chat.ID, tr(msg, "interval.show", feed.Period(), feed.NextUpdate.Format("2006-01-02 15:04:05")), msg.MessageID)
+		return
+	}
+
+	if args[1] == "default" {
+		feed.UpdatePeriod = 0
+	} else if feed.UpdatePeriod, err = time.ParseDuration(args[1]); err != nil || feed.UpdatePeriod < time.Minute {
+		sendMessage(msg.Chat.ID, tr(msg, "interval.invalid"), msg.MessageID)
+		return
+	}
+	feed.NextUpdate = time.Now()
+	if err = dbUpdateFeedPeriod(&feed); err != nil {
+		log.Errorf("Unable to update feed %s: %s", feed.URL, err)
+		sendMessage(msg.Chat.ID, tr(msg, "common.error"), msg.MessageID)
+		return
+	}
+	sendMessage(msg.Chat.ID, tr(msg, "common.done"), msg.MessageID)
+}
+
+func commandsFeedFilterHandler(msg *tgbotapi.Message) {
+	args := strings.Fields(msg.CommandArguments())
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "add":
+		if len(args) < 4 {
+			sendMessage(msg.Chat.ID, tr(msg, "filter.args_required"), msg.MessageID)
+			return
+		}
+		if _, err := dbGetFeedSubscription(args[1], msg.Chat.ID); err == ErrorSubscriptionNotFound {
+			sendMessage(msg.Chat.ID, tr(msg, "feed.not_in_chat"), msg.MessageID)
+			return
+		} else if err != nil {
+			log.Errorf("Unable to get subscription for feed %s: %s", args[1], err)
+			return
+		}
+
+		filter, err := newFeedFilter(args[1], msg.Chat.ID, args[2], strings.Join(args[3:], " "))
+		if err != nil {
+			sendMessage(msg.Chat.ID, tr(msg, "filter.invalid", err), msg.MessageID)
+			return
+		}
+		if err = dbAddFeedFilter(&filter); err != nil {
+			log.Errorf("Unable to add feed filter: %s", err)
+			sendMessage(msg.Chat.ID, tr(msg, "common.error"), msg.MessageID)
+			return
+		}
+		sendMessage(msg.Chat.ID, tr(msg, "filter.added", filter.String()), msg.MessageID)
+	case "del":
+		if len(args) < 2 {
+			sendMessage(msg.Chat.ID, tr(msg, "filter.id_required"), msg.MessageID)
+			return
+		}
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			sendMessage(msg.Chat.ID, tr(msg, "filter.id_number"), msg.MessageID)
+			return
+		}
+		if err = dbDelFeedFilter(id, msg.Chat.ID); err == ErrorFilterNotFound {
+			sendMessage(msg.Chat.ID, tr(msg, "filter.not_found"), msg.MessageID)
+			return
+		} else if err != nil {
+			log.Errorf("Unable to delete feed filter %d: %s", id, err)
+			sendMessage(msg.Chat.ID, tr(msg, "common.error"), msg.MessageID)
+			return
+		}
+		sendMessage(msg.Chat.ID, tr(msg, "common.deleted"), msg.MessageID)
+	case "list":
+		filters, err := dbGetChatFeedFilters(msg.Chat.ID)
+		if err != nil {
+			log.Errorf("Unable to get filters of chat %d: %s", msg.Chat.ID, err)
+			return
+		}
+		if len(filters) == 0 {
+			sendMessage(msg.Chat.ID, tr(msg, "filter.empty"), msg.MessageID)
+			return
+		}
+		var lines []string
+		url := ""
+		for _, filter := range filters {
+			if filter.FeedURL != url {
+				url = filter.FeedURL
+				lines = append(lines, url)
+			}
+			lines = append(lines, "  "+filter.String())
+		}
+		sendMessage(msg.Chat.ID, tr(msg, "filter.list", strings.Join(lines, "\n")), msg.MessageID)
+	default:
+		sendMessage(msg.Chat.ID, tr(msg, "common.unknown_subcommand", args[0]), msg.MessageID)
+	}
+}
+
+func commandsFeedModeHandler(msg *tgbotapi.Message) {
+	args := strings.Fields(msg.CommandArguments())
+	if len(args) == 0 {
+		sendMessage(msg.Chat.ID, tr(msg, "mode.args_required"), msg.MessageID)
+		return
+	}
+
+	sub, err := dbGetFeedSubscription(args[0], msg.Chat.ID)
+	if err == ErrorSubscriptionNotFound {
+		sendMessage(msg.Chat.ID, tr(msg, "feed.not_in_chat"), msg.MessageID)
+		return
+	} else if err != nil {
+		log.Errorf("Unable to get subscription for feed %s: %s", args[0], err)
+		return
+	}
+	if len(args) == 1 {
+		sendMessage(msg.Chat.ID, tr(msg, "mode.show", sub.ModeString(msgLocale(msg))), msg.MessageID)
+		return
+	}
+
+	mode, ok := parseFeedMode(args[1])
+	if !ok {
+		sendMessage(msg.Chat.ID, tr(msg, "mode.invalid"), msg.MessageID)
+		return
+	}
+	sub.DigestTime = ""
+	if mode == feedModeDaily && len(args) > 2 {
+		if _, _, err = parseDigestTime(args[2]); err != nil {
+			sendMessage(msg.Chat.ID, tr(msg, "mode.time_invalid"), msg.MessageID)
+			return
+		}
+		sub.DigestTime = args[2]
+	}
+	wasDigest := sub.IsDigest()
+	sub.Mode = mode
+	sub.LastDigest = time.Now()
+	if err = dbUpdateFeedSubscriptionMode(&sub); err != nil {
+		log.Errorf("Unable to update subscription for feed %s: %s", sub.FeedURL, err)
+		sendMessage(msg.Chat.ID, tr(msg, "common.error"), msg.MessageID)
+		return
+	}
+	sendMessage(msg.Chat.ID, tr(msg, "mode.show", sub.ModeString(msgLocale(msg))), msg.MessageID)
+
+	// queued news are not lost when digest is turned off
+	if wasDigest && !sub.IsDigest() {
+		feedDigestSend(sub)
+	}
+}
+
+func commandsFeedNotifyHandler(msg *tgbotapi.Message) {
+	args := strings.Fields(msg.CommandArguments())
+	if len(args) < 2 || (args[1] != "on" && args[1] != "off") {
+		sendMessage(msg.Chat.ID, tr(msg, "notify.args_required"), msg.MessageID)
+		return
+	}
+
+	sub, err := dbGetFeedSubscription(args[0], msg.Chat.ID)
+	if err == ErrorSubscriptionNotFound {
+		sendMessage(msg.Chat.ID, tr(msg, "feed.not_in_chat"), msg.MessageID)
+		return
+	} else if err != nil {
+		log.Errorf("Unable to get subscription for feed %s: %s", args[0], err)
+		return
+	}
+
+	sub.Notify = args[1] == "on"
+	if err = dbUpdateFeedSubscriptionMode(&sub); err != nil {
+		log.Errorf("Unable to update subscription for feed %s: %s", sub.FeedURL, err)
+		sendMessage(msg.Chat.ID, tr(msg, "common.error"), msg.MessageID)
+		return
+	}
+	sendMessage(msg.Chat.ID, tr(msg, "common.done"), msg.MessageID)
+}
+
+// commandsFeedStatusHandler shows health and statistics of feeds in chat, all feeds are shown for bot admins with `all` argument
+func commandsFeedStatusHandler(msg *tgbotapi.Message) {
+	var (
+		subs  []FeedSubscription
+		feeds []Feeder
+		lines []string
+		err   error
+	)
+	if strings.TrimSpace(msg.CommandArguments()) == "all" {
+		if !userHasRole(msg.Chat, msg.From, RoleBotAdmin) {
+			sendMessage(msg.Chat.ID, tr(msg, "common.forbidden"), msg.MessageID)
+			return
+		}
+		if feeds, err = dbGetAllFeeds(); err != nil {
+			log.Errorf("Unable to get all feeds: %s", err)
+			return
+		}
+		for _, feed := range feeds {
+			lines = append(lines, fmt.Sprintf("%s\n%s", feed.URL, feed.StatusString(msgLocale(msg))))
+		}
+		sendMessage(msg.Chat.ID, tr(msg, "status.list", strings.Join(lines, "\n")), msg.MessageID)
 		return
 	}
 
+	if subs, err = dbGetChatFeedSubscriptions(msg.Chat.ID); err != nil {
+		log.Errorf("Unable to get subscriptions of chat %d: %s", msg.Chat.ID, err)
+		return
+	}
+	if len(subs) == 0 {
+		sendMessage(msg.Chat.ID, tr(msg, "feeds.empty"), msg.MessageID)
+		return
+	}
+	if feeds, err = dbGetChatFeeds(msg.Chat.ID); err != nil {
+		log.Errorf("Unable to get feeds of chat %d: %s", msg.Chat.ID, err)
+		return
+	}
+	health := make(map[string]string)
 	for _, feed := range feeds {
-		urls = append(urls, fmt.Sprintf("[%s](%s)", feed.Name, feed.URL))
+		health[feed.URL] = feed.StatusString(msgLocale(msg))
 	}
 
-	sendMessage(msg.Chat.ID, fmt.Sprintf("Источники: \n%s", strings.Join(urls, "\n")), 0)
+	for _, sub := range subs {
+		lines = append(lines, tr(msg, "status.subscription", sub.FeedURL, sub.Delivered, sub.Suppressed, sub.ModeString(msgLocale(msg)), onOffString(msgLocale(msg), sub.Notify), health[sub.FeedURL]))
+	}
+	sendMessage(msg.Chat.ID, tr(msg, "status.list", strings.Join(lines, "\n")), msg.MessageID)
 }
 
-func commandsAddInsult(msg *tgbotapi.Message, isWord bool) {
-	if !userIDIsAuthForInsult(msg.From) {
-		sendMessage(msg.Chat.ID, "Тебе этого нельзя!", msg.MessageID)
-		log.Debugf("Command add_insult without authorization %s", msg.From.String())
+func commandsFeedEnableHandler(msg *tgbotapi.Message) {
+	url := strings.TrimSpace(msg.CommandArguments())
+	if url == "" {
+		sendMessage(msg.Chat.ID, tr(msg, "enable.url_required"), msg.MessageID)
+		return
+	}
+	if _, err := dbGetFeedSubscription(url, msg.Chat.ID); err == ErrorSubscriptionNotFound && !userHasRole(msg.Chat, msg.From, RoleBotAdmin) {
+		sendMessage(msg.Chat.ID, tr(msg, "feed.not_in_chat"), msg.MessageID)
+		return
+	} else if err != nil && err != ErrorSubscriptionNotFound {
+		log.Errorf("Unable to get subscription for feed %s: %s", url, err)
+		return
+	}
+
+	feed, err := dbGetFeed(url)
+	if err != nil {
+		sendMessage(msg.Chat.ID, tr(msg, "feed.unknown"), msg.MessageID)
+		log.Debugf("Unable to get feed %s: %s", url, err)
+		return
+	}
+	feed.Disabled = false
+	feed.ErrorCount = 0
+	feed.NextUpdate = time.Now()
+	if err = dbEnableFeed(&feed); err != nil {
+		log.Errorf("Unable to update feed %s: %s", feed.URL, err)
+		sendMessage(msg.Chat.ID, tr(msg, "common.error"), msg.MessageID)
+		return
+	}
+	sendMessage(msg.Chat.ID, tr(msg, "common.enabled"), msg.MessageID)
+}
+
+// commandsFeedTemplateScope parses scope of template, global and feed scopes are allowed for bot admins only
+func commandsFeedTemplateScope(msg *tgbotapi.Message, args string) (tmpl FeedTemplate, rest string, ok bool) {
+	words, rest := splitArguments(args, 1)
+	if len(words) == 0 {
+		sendMessage(msg.Chat.ID, tr(msg, "template.scope_required"), msg.MessageID)
+		return
+	}
+
+	scope := strings.ToLower(words[0])
+	switch scope {
+	case "global":
+	case "feed", "chat":
+		if scope == "chat" {
+			tmpl.ChatID = msg.Chat.ID
+		}
+		if strings.HasPrefix(rest, "http://") || strings.HasPrefix(rest, "https://") {
+			words, rest = splitArguments(rest, 1)
+			tmpl.FeedURL = words[0]
+		} else if scope == "feed" {
+			sendMessage(msg.Chat.ID, tr(msg, "template.url_required"), msg.MessageID)
+			return
+		}
+	default:
+		sendMessage(msg.Chat.ID, tr(msg, "template.unknown_scope", words[0]), msg.MessageID)
 		return
 	}
+
+	if tmpl.ChatID == 0 && !userHasRole(msg.Chat, msg.From, RoleBotAdmin) {
+		sendMessage(msg.Chat.ID, tr(msg, "common.forbidden"), msg.MessageID)
+		return
+	}
+	return tmpl, rest, true
+}
+
+func commandsFeedTemplateHandler(msg *tgbotapi.Message) {
+	words, rest := splitArguments(msg.CommandArguments(), 1)
+	if len(words) == 0 {
+		words = []string{"list"}
+	}
+
+	switch strings.ToLower(words[0]) {
+	case "set":
+		tmpl, text, ok := commandsFeedTemplateScope(msg, rest)
+		if !ok {
+			return
+		}
+		if text == "" {
+			sendMessage(msg.Chat.ID, tr(msg, "template.text_required"), msg.MessageID)
+			return
+		}
+		if err := feedValidateTemplate(text); err != nil {
+			sendMessage(msg.Chat.ID, tr(msg, "template.invalid", err), msg.MessageID)
+			return
+		}
+		tmpl.Template = text
+		if err := dbSetFeedTemplate(tmpl); err != nil {
+			log.Errorf("Unable to set feed template: %s", err)
+			sendMessage(msg.Chat.ID, tr(msg, "common.error"), msg.MessageID)
+			return
+		}
+		sendMessage(msg.Chat.ID, tr(msg, "common.saved"), msg.MessageID)
+	case "del":
+		tmpl, _, ok := commandsFeedTemplateScope(msg, rest)
+		if !ok {
+			return
+		}
+		if err := dbDelFeedTemplate(tmpl.FeedURL, tmpl.ChatID); err == ErrorTemplateNotFound {
+			sendMessage(msg.Chat.ID, tr(msg, "template.not_found"), msg.MessageID)
+			return
+		} else if err != nil {
+			log.Errorf("Unable to delete feed template: %s", err)
+			sendMessage(msg.Chat.ID, tr(msg, "common.error"), msg.MessageID)
+			return
+		}
+		sendMessage(msg.Chat.ID, tr(msg, "common.deleted"), msg.MessageID)
+	case "preview":
+		commandsFeedTemplatePreview(msg, rest)
+	case "list":
+		templates, err := dbGetChatFeedTemplates(msg.Chat.ID)
+		if err != nil {
+			log.Errorf("Unable to get templates of chat %d: %s", msg.Chat.ID, err)
+			return
+		}
+		if len(templates) == 0 {
+			sendMessage(msg.Chat.ID, tr(msg, "template.empty"), msg.MessageID)
+			return
+		}
+		var list []string
+		for _, tmpl := range templates {
+			list = append(list, tmpl.String())
+		}
+		sendText(msg.Chat.ID, newText().Plain(tr(msg, "template.list")).Line().Pre(strings.Join(list, "\n\n")), msg.MessageID)
+	default:
+		sendMessage(msg.Chat.ID, tr(msg, "common.unknown_subcommand", words[0]), msg.MessageID)
+	}
+}
+
+// commandsFeedTemplatePreview renders template with latest item of feed or sample news if feed is not set
+func commandsFeedTemplatePreview(msg *tgbotapi.Message, args string) {
+	url := ""
+	news := feedSampleNews
+	if strings.HasPrefix(args, "http://") || strings.HasPrefix(args, "https://") {
+		var words []string
+		words, args = splitArguments(args, 1)
+		url = words[0]
+
+		ctx, cancel := context.WithTimeout(context.Background(), options.FeedsDeadline)
+		defer cancel()
+		fd, err := feedFetch(feedPublicOnly(ctx), &Feeder{URL: url})
+		if err == nil && fd == nil {
+			err = fmt.Errorf("unexpected not modified answer")
+		}
+		if err != nil {
+			sendMessage(msg.Chat.ID, tr(msg, "template.feed_error", err), msg.MessageID)
+			return
+		}
+		if len(fd.Items) == 0 {
+			sendMessage(msg.Chat.ID, tr(msg, "template.no_news"), msg.MessageID)
+			return
+		}
+		news = feedNewsFromItem(url, fd, fd.Items[0])
+	}
+
+	text := args
+	if text == "" {
+		templates, err := dbGetFeedTemplates(url)
+		if err != nil {
+			log.Errorf("Unable to get templates of feed %s: %s", url, err)
+			return
+		}
+		text = feedTemplateFor(templates, url, msg.Chat.ID)
+	} else if err := feedValidateTemplate(text); err != nil {
+		sendMessage(msg.Chat.ID, tr(msg, "template.invalid", err), msg.MessageID)
+		return
+	}
+
+	result, err := feedPreviewNews(text, news)
+	if err != nil {
+		sendMessage(msg.Chat.ID, tr(msg, "template.invalid", err), msg.MessageID)
+		return
+	}
+	sendText(msg.Chat.ID, newText().Raw(result), msg.MessageID)
+}
+
+func commandsAddInsult(msg *tgbotapi.Message, isWord bool) {
 	if msg.CommandArguments() == "" {
-		sendMessage(msg.Chat.ID, "Задай аргумент(ы) - слово или слова", msg.MessageID)
+		sendMessage(msg.Chat.ID, tr(msg, "insult.args_required"), msg.MessageID)
 		log.Debugf("Command add_insult without arguments from %s", msg.From.String())
 		return
 	}
@@ -431,27 +1090,22 @@ func commandsAddInsult(msg *tgbotapi.Message, isWord bool) {
 			log.Errorf("Unable to add insult word or target %s: %s", word, err)
 			continue
 		} else if err == ErrorWordAlreadyExists {
-			part := "Такое слово"
+			key := "insult.word_exists"
 			if !isWord {
-				part = "Такая цель"
+				key = "insult.target_exists"
 			}
-			sendMessage(msg.Chat.ID, fmt.Sprintf("%s (%s) уже существует", part, word), msg.MessageID)
+			sendMessage(msg.Chat.ID, tr(msg, key, word), msg.MessageID)
 			log.Errorf("Unable to add insult word or target %s: %s", word, err)
 			continue
 		}
 	}
 
-	sendMessage(msg.Chat.ID, fmt.Sprintf("Добавил"), msg.MessageID)
+	sendMessage(msg.Chat.ID, tr(msg, "common.added"), msg.MessageID)
 }
 
 func commandsDelInsult(msg *tgbotapi.Message, isWord bool) {
-	if !userIDIsAuthForInsult(msg.From) {
-		sendMessage(msg.Chat.ID, "Тебе этого нельзя!", msg.MessageID)
-		log.Debugf("Command del_insult without authorization %s", msg.From.String())
-		return
-	}
 	if msg.CommandArguments() == "" {
-		sendMessage(msg.Chat.ID, "Задай аргумент(ы) - слово или слова", msg.MessageID)
+		sendMessage(msg.Chat.ID, tr(msg, "insult.args_required"), msg.MessageID)
 		log.Debugf("Command del_insult without arguments from %s", msg.From.String())
 		return
 	}
@@ -462,16 +1116,16 @@ func commandsDelInsult(msg *tgbotapi.Message, isWord bool) {
 			log.Errorf("Unable to del insult word or target %s: %s", word, err)
 			return
 		} else if err == ErrorWordNotFound {
-			part := "Такое слово"
+			key := "insult.word_not_found"
 			if !isWord {
-				part = "Такая цель"
+				key = "insult.target_not_found"
 			}
-			sendMessage(msg.Chat.ID, fmt.Sprintf("%s (%s) отсутствует в базе", part, word), msg.MessageID)
+			sendMessage(msg.Chat.ID, tr(msg, key, word), msg.MessageID)
 			log.Errorf("Unable to add insult word or target %s: %s", word, err)
 			return
 		}
 	}
-	sendMessage(msg.Chat.ID, fmt.Sprintf("Удалил"), msg.MessageID)
+	sendMessage(msg.Chat.ID, tr(msg, "common.deleted"), msg.MessageID)
 }
 
 func commandsShowInsult(msg *tgbotapi.Message) {
@@ -485,7 +1139,7 @@ func commandsShowInsult(msg *tgbotapi.Message) {
 	}
 
 	if len(words) > 0 {
-		sendMessage(msg.Chat.ID, fmt.Sprintf("*Цели*:\n%s", strings.Join(words, "\n")), 0)
+		sendText(msg.Chat.ID, newText().Bold(tr(msg, "insult.targets")).Plain(":").Line().Plain(strings.Join(words, "\n")), 0)
 	}
 
 	if words, err = dbInsultGetWordsOrTargets(true); err != nil {
@@ -494,25 +1148,294 @@ func commandsShowInsult(msg *tgbotapi.Message) {
 	}
 
 	if len(words) > 0 {
-		sendMessage(msg.Chat.ID, fmt.Sprintf("*Оскорбления*:\n%s", strings.Join(words, "\n")), 0)
+		sendText(msg.Chat.ID, newText().Bold(tr(msg, "insult.words")).Plain(":").Line().Plain(strings.Join(words, "\n")), 0)
+	}
+}
+
+func commandsChatSettingsAllowed(msg *tgbotapi.Message) bool {
+	if !msg.Chat.IsGroup() && !msg.Chat.IsSuperGroup() {
+		sendMessage(msg.Chat.ID, tr(msg, "common.groups_only"), msg.MessageID)
+		return false
+	}
+	return true
+}
+
+func commandsSlowModeHandler(msg *tgbotapi.Message) {
+	if !commandsChatSettingsAllowed(msg) {
+		return
+	}
+	settings, err := chatSettings.Get(msg.Chat.ID)
+	if err != nil {
+		log.Errorf("Unable to get settings for chat %d: %s", msg.Chat.ID, err)
+		return
+	}
+
+	args := strings.TrimSpace(msg.CommandArguments())
+	switch args {
+	case "":
+		if settings.SlowModeSeconds == 0 {
+			sendMessage(msg.Chat.ID, tr(msg, "slow.off"), msg.MessageID)
+		} else {
+			sendMessage(msg.Chat.ID, msgLocale(msg).N("slow.show", settings.SlowModeSeconds, settings.SlowModeSeconds), msg.MessageID)
+		}
+		return
+	case "off", "0":
+		settings.SlowModeSeconds = 0
+	default:
+		seconds, err := strconv.Atoi(args)
+		if err != nil || seconds < 0 {
+			sendMessage(msg.Chat.ID, tr(msg, "slow.args_required"), msg.MessageID)
+			return
+		}
+		settings.SlowModeSeconds = seconds
+	}
+
+	if err = chatSettings.Set(settings); err != nil {
+		log.Errorf("Unable to save settings for chat %d: %s", msg.Chat.ID, err)
+		sendMessage(msg.Chat.ID, tr(msg, "common.error"), msg.MessageID)
+		return
 	}
+	sendMessage(msg.Chat.ID, tr(msg, "common.done"), msg.MessageID)
 }
 
-func userIDIsAuthForInsult(user *tgbotapi.User) (authorized bool) {
-	authInsultUsers := []int{
-		204176584, // xvitaly
-		217969480, // elemc
-		47960317,  // ignatenkobrain
-		103761953, // vrutkovs
-		170389127, // vascom
+func commandsNightModeHandler(msg *tgbotapi.Message) {
+	if !commandsChatSettingsAllowed(msg) {
+		return
+	}
+	settings, err := chatSettings.Get(msg.Chat.ID)
+	if err != nil {
+		log.Errorf("Unable to get settings for chat %d: %s", msg.Chat.ID, err)
+		return
+	}
+
+	args := strings.TrimSpace(msg.CommandArguments())
+	switch args {
+	case "":
+		if !settings.NightMode {
+			sendMessage(msg.Chat.ID, tr(msg, "night.off"), msg.MessageID)
+		} else {
+			sendMessage(msg.Chat.ID, tr(msg, "night.show", settings.NightModeStart, settings.NightModeEnd, settings.Location().String()), msg.MessageID)
+		}
+		return
+	case "off":
+		settings.NightMode = false
+	default:
+		var start, end int
+		if start, end, err = parseHoursRange(args); err != nil {
+			sendMessage(msg.Chat.ID, tr(msg, "night.args_required"), msg.MessageID)
+			return
+		}
+		settings.NightMode = true
+		settings.NightModeStart = start
+		settings.NightModeEnd = end
+	}
+
+	if err = chatSettings.Set(settings); err != nil {
+		log.Errorf("Unable to save settings for chat %d: %s", msg.Chat.ID, err)
+		sendMessage(msg.Chat.ID, tr(msg, "common.error"), msg.MessageID)
+		return
 	}
+	sendMessage(msg.Chat.ID, tr(msg, "common.done"), msg.MessageID)
+}
 
-	for _, u := range authInsultUsers {
-		if user.ID == u {
-			authorized = true
+func commandsQuietHoursHandler(msg *tgbotapi.Message) {
+	if !commandsChatSettingsAllowed(msg) {
+		return
+	}
+	settings, err := chatSettings.Get(msg.Chat.ID)
+	if err != nil {
+		log.Errorf("Unable to get settings for chat %d: %s", msg.Chat.ID, err)
+		return
+	}
+
+	args := strings.Fields(msg.CommandArguments())
+	switch {
+	case len(args) == 0:
+		if !settings.QuietHours {
+			sendMessage(msg.Chat.ID, tr(msg, "quiet.off"), msg.MessageID)
+			return
+		}
+		delivery := tr(msg, "quiet.one_by_one")
+		if settings.QuietDigest {
+			delivery = tr(msg, "quiet.digest")
+		}
+		sendMessage(msg.Chat.ID, tr(msg, "quiet.show", settings.QuietStart, settings.QuietEnd, settings.Location().String(), delivery), msg.MessageID)
+		return
+	case args[0] == "off":
+		settings.QuietHours = false
+	default:
+		var start, end int
+		if start, end, err = parseHoursRange(args[0]); err != nil || (len(args) > 1 && args[1] != "digest") {
+			sendMessage(msg.Chat.ID, tr(msg, "quiet.args_required"), msg.MessageID)
 			return
 		}
+		settings.QuietHours = true
+		settings.QuietStart = start
+		settings.QuietEnd = end
+		settings.QuietDigest = len(args) > 1
+	}
+
+	if err = chatSettings.Set(settings); err != nil {
+		log.Errorf("Unable to save settings for chat %d: %s", msg.Chat.ID, err)
+		sendMessage(msg.Chat.ID, tr(msg, "common.error"), msg.MessageID)
+		return
+	}
+	sendMessage(msg.Chat.ID, tr(msg, "common.done"), msg.MessageID)
+}
+
+func commandsTimezoneHandler(msg *tgbotapi.Message) {
+	if !commandsChatSettingsAllowed(msg) {
+		return
+	}
+	settings, err := chatSettings.Get(msg.Chat.ID)
+	if err != nil {
+		log.Errorf("Unable to get settings for chat %d: %s", msg.Chat.ID, err)
+		return
+	}
+
+	args := strings.TrimSpace(msg.CommandArguments())
+	if args == "" {
+		sendMessage(msg.Chat.ID, tr(msg, "timezone.show", settings.Location().String()), msg.MessageID)
+		return
+	}
+	if _, err = time.LoadLocation(args); err != nil {
+		sendMessage(msg.Chat.ID, tr(msg, "timezone.unknown", args), msg.MessageID)
+		return
+	}
+
+	settings.Timezone = args
+	if err = chatSettings.Set(settings); err != nil {
+		log.Errorf("Unable to save settings for chat %d: %s", msg.Chat.ID, err)
+		sendMessage(msg.Chat.ID, tr(msg, "common.error"), msg.MessageID)
+		return
+	}
+	sendMessage(msg.Chat.ID, tr(msg, "common.done"), msg.MessageID)
+}
+
+// commandsLangHandler shows or sets language of chat, only moderators change it in groups
+func commandsLangHandler(msg *tgbotapi.Message) {
+	settings, err := chatSettings.Get(msg.Chat.ID)
+	if err != nil {
+		log.Errorf("Unable to get settings for chat %d: %s", msg.Chat.ID, err)
+		return
+	}
+
+	args := strings.ToLower(strings.TrimSpace(msg.CommandArguments()))
+	if args == "" {
+		current := settings.Language
+		if current == "" {
+			current = "auto"
+		}
+		sendMessage(msg.Chat.ID, tr(msg, "lang.show", current, msgLocale(msg), strings.Join(availableLocales(), ", ")), msg.MessageID)
+		return
+	}
+	if !msg.Chat.IsPrivate() && !userHasRole(msg.Chat, msg.From, RoleChatModerator) {
+		sendMessage(msg.Chat.ID, tr(msg, "common.forbidden"), msg.MessageID)
+		return
+	}
+
+	if args == "auto" {
+		settings.Language = ""
+	} else if locale := localeFor(args); locale != "" {
+		settings.Language = string(locale)
+	} else {
+		sendMessage(msg.Chat.ID, tr(msg, "lang.unknown", args, strings.Join(availableLocales(), ", ")), msg.MessageID)
+		return
+	}
+	if err = chatSettings.Set(settings); err != nil {
+		log.Errorf("Unable to save settings for chat %d: %s", msg.Chat.ID, err)
+		sendMessage(msg.Chat.ID, tr(msg, "common.error"), msg.MessageID)
+		return
+	}
+	sendMessage(msg.Chat.ID, tr(msg, "common.done"), msg.MessageID)
+}
+
+func commandsRoleHandler(msg *tgbotapi.Message, grant bool) {
+	args := strings.Fields(msg.CommandArguments())
+	if len(args) == 0 {
+		sendMessage(msg.Chat.ID, tr(msg, "role.args_required"), msg.MessageID)
+		return
+	}
+
+	role, ok := parseRole(args[0])
+	if !ok || role == RoleMember || role == RoleOwner {
+		sendMessage(msg.Chat.ID, tr(msg, "role.unknown", args[0]), msg.MessageID)
+		return
+	}
+	// only roles lower than own role can be granted or revoked
+	if userRole(msg.Chat, msg.From) <= role {
+		sendMessage(msg.Chat.ID, tr(msg, "common.forbidden"), msg.MessageID)
+		log.Debugf("Command `%s` from %s for role %s without authorization", msg.Command(), msg.From.String(), role)
+		return
+	}
+
+	var (
+		user *tgbotapi.User
+		err  error
+	)
+	if len(args) > 1 {
+		username := strings.Join(args[1:], " ")
+		if user, err = getUser(username); err != nil {
+			if err == ErrorUserNotFound {
+				sendMessage(msg.Chat.ID, tr(msg, "user.not_found", username), msg.MessageID)
+				return
+			}
+			sendMessage(msg.Chat.ID, tr(msg, "role.user_error", err), msg.MessageID)
+			return
+		}
+	} else if msg.ReplyToMessage != nil && msg.ReplyToMessage.From != nil {
+		user = msg.ReplyToMessage.From
+	} else {
+		sendMessage(msg.Chat.ID, tr(msg, "role.whom"), msg.MessageID)
+		return
+	}
+
+	chatID := msg.Chat.ID
+	if role.IsGlobal() {
+		chatID = 0
+	} else if !msg.Chat.IsGroup() && !msg.Chat.IsSuperGroup() {
+		sendMessage(msg.Chat.ID, tr(msg, "role.group_only", role), msg.MessageID)
+		return
+	}
+
+	if grant {
+		err = dbSetUserRole(UserRole{UserID: user.ID, ChatID: chatID, Role: role.String()})
+	} else {
+		err = dbDelUserRole(user.ID, chatID)
+	}
+	if err == ErrorRoleNotFound {
+		sendMessage(msg.Chat.ID, tr(msg, "role.not_granted", user.String()), msg.MessageID)
+		return
+	} else if err != nil {
+		log.Errorf("Unable to change role %s of user %s: %s", role, user.String(), err)
+		sendMessage(msg.Chat.ID, tr(msg, "common.error"), msg.MessageID)
+		return
+	}
+
+	log.Infof("Role %s of user %s changed by %s (grant=%t, chat=%d)", role, user.String(), msg.From.String(), grant, chatID)
+	sendMessage(msg.Chat.ID, tr(msg, "common.done"), msg.MessageID)
+}
+
+func commandsShowRolesHandler(msg *tgbotapi.Message) {
+	var (
+		roles []UserRole
+		lines []string
+		err   error
+	)
+	if roles, err = dbGetChatRoles(msg.Chat.ID); err != nil {
+		log.Errorf("Unable to get roles for chat %d: %s", msg.Chat.ID, err)
+		return
+	}
+
+	for _, id := range options.Owners {
+		lines = append(lines, fmt.Sprintf("%s - %s", userNameByID(id), RoleOwner))
+	}
+	for _, role := range roles {
+		lines = append(lines, fmt.Sprintf("%s - %s", userNameByID(role.UserID), role.Role))
+	}
+	if options.ChatAdminRole != RoleMember {
+		lines = append(lines, tr(msg, "role.chat_admins", options.ChatAdminRole))
 	}
 
-	return
+	sendMessage(msg.Chat.ID, tr(msg, "role.list", strings.Join(lines, "\n")), msg.MessageID)
 }
@@ -22,11 +22,41 @@ type Options struct {
 	Debug             bool
 	StaticDirPath     string
 	MaximumFloodLevel int
+	Language          string
+	LocalesPath       string
 
 	CacheDuration     time.Duration
 	CacheUpdatePeriod time.Duration
 
 	FeedsUpdatePeriod time.Duration
+	FeedsFetchTimeout time.Duration
+	FeedsMaxSize      int64
+	FeedsMaxBackoff   time.Duration
+	FeedsConcurrency  int
+	FeedsDeadline     time.Duration
+	FeedsTemplate     string
+	FeedsDigestTime   string
+	FeedsDedupByLink  bool
+	FeedsRetention    time.Duration
+	FeedsDisableAfter int
+
+	BlocklistSource       string
+	BlocklistUpdatePeriod time.Duration
+
+	OutgoingGlobalRate    float64
+	OutgoingChatInterval  time.Duration
+	OutgoingGroupInterval time.Duration
+	OutgoingRetries       int
+	OutgoingDocumentSize  int
+	OutgoingParseMode     string
+
+	CommandCooldowns map[string]CommandCooldown
+	DNFMaxProcesses  int
+
+	Owners        []int
+	ChatAdminRole Role
+
+	APITokens []string
 }
 
 var options *Options
@@ -52,9 +82,97 @@ func LoadConfig() (err error) {
 		Debug:             viper.GetBool("main.debug"),
 		StaticDirPath:     viper.GetString("main.static_path"),
 		MaximumFloodLevel: viper.GetInt("main.maximum_flood_level"),
+		Language:          viper.GetString("main.language"),
+		LocalesPath:       viper.GetString("main.locales_path"),
 		CacheDuration:     viper.GetDuration("cache.duration"),
 		CacheUpdatePeriod: viper.GetDuration("cache.update_period"),
 		FeedsUpdatePeriod: viper.GetDuration("feeds.update_period"),
+		FeedsFetchTimeout: viper.GetDuration("feeds.fetch_timeout"),
+		FeedsMaxSize:      viper.GetInt64("feeds.max_size"),
+		FeedsMaxBackoff:   viper.GetDuration("feeds.max_backoff"),
+		FeedsConcurrency:  viper.GetInt("feeds.concurrency"),
+		FeedsDeadline:     viper.GetDuration("feeds.deadline"),
+		FeedsTemplate:     viper.GetString("feeds.template"),
+		FeedsDigestTime:   viper.GetString("feeds.digest_time"),
+		FeedsDedupByLink:  viper.GetBool("feeds.dedup_by_link"),
+		FeedsRetention:    viper.GetDuration("feeds.news_retention"),
+		FeedsDisableAfter: viper.GetInt("feeds.disable_after"),
+
+		BlocklistSource:       viper.GetString("blocklist.source"),
+		BlocklistUpdatePeriod: viper.GetDuration("blocklist.update_period"),
+
+		OutgoingGlobalRate:    viper.GetFloat64("telegram.global_rate"),
+		OutgoingChatInterval:  viper.GetDuration("telegram.chat_interval"),
+		OutgoingGroupInterval: viper.GetDuration("telegram.group_interval"),
+		OutgoingRetries:       viper.GetInt("telegram.retries"),
+		OutgoingDocumentSize:  viper.GetInt("telegram.document_size"),
+		OutgoingParseMode:     viper.GetString("telegram.parse_mode"),
+
+		CommandCooldowns: loadCommandCooldowns(),
+		DNFMaxProcesses:  viper.GetInt("main.dnf_max_processes"),
+
+		Owners:        loadOwners(),
+		ChatAdminRole: loadChatAdminRole(),
+
+		APITokens: viper.GetStringSlice("api.tokens"),
+	}
+	if options.Language == "" {
+		options.Language = "ru"
+	}
+	if options.LocalesPath == "" {
+		options.LocalesPath = "locales"
+	}
+	if options.FeedsFetchTimeout <= 0 {
+		options.FeedsFetchTimeout = 30 * time.Second
+	}
+	if options.FeedsMaxSize <= 0 {
+		options.FeedsMaxSize = 5 * 1024 * 1024
+	}
+	if options.FeedsMaxBackoff <= 0 {
+		options.FeedsMaxBackoff = 6 * time.Hour
+	}
+	if options.FeedsMaxBackoff < options.FeedsUpdatePeriod {
+		options.FeedsMaxBackoff = options.FeedsUpdatePeriod
+	}
+	if options.FeedsConcurrency <= 0 {
+		options.FeedsConcurrency = 4
+	}
+	if options.FeedsDeadline <= 0 {
+		options.FeedsDeadline = 2 * options.FeedsFetchTimeout
+	}
+	// formatter is used by validation of template
+	formatter = newFormatter(options.OutgoingParseMode)
+	if options.FeedsTemplate != "" {
+		if err := feedValidateTemplate(options.FeedsTemplate); err != nil {
+			log.Warnf("Invalid feeds template in configuration, default template is used: %s", err)
+			options.FeedsTemplate = ""
+		}
+	}
+	if _, _, err := parseDigestTime(options.FeedsDigestTime); err != nil {
+		options.FeedsDigestTime = "09:00"
+	}
+	// retention is enabled by default, it is disabled by zero value
+	if !viper.IsSet("feeds.news_retention") {
+		options.FeedsRetention = 90 * 24 * time.Hour
+	}
+	if options.FeedsDisableAfter <= 0 {
+		options.FeedsDisableAfter = 20
+	}
+	// limits of Telegram: about 30 messages per second, 1 message per second to chat and 20 messages per minute to group
+	if options.OutgoingGlobalRate <= 0 {
+		options.OutgoingGlobalRate = 25
+	}
+	if options.OutgoingChatInterval <= 0 {
+		options.OutgoingChatInterval = time.Second
+	}
+	if options.OutgoingGroupInterval <= 0 {
+		options.OutgoingGroupInterval = 3 * time.Second
+	}
+	if !viper.IsSet("telegram.retries") {
+		options.OutgoingRetries = 3
+	}
+	if options.DNFMaxProcesses <= 0 {
+		options.DNFMaxProcesses = 1
 	}
 	return
 }
@@ -0,0 +1,178 @@
+// -*- Go -*-
+/* ------------------------------------------------ */
+/* Golang source                                    */
+/* Author: Alexei Panov <me@elemc.name> 			*/
+/* ------------------------------------------------ */
+
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+// CommandCooldown is a type for store cooldowns of command
+type CommandCooldown struct {
+	User   time.Duration
+	Chat   time.Duration
+	Notify bool
+}
+
+const (
+	cooldownSweepPeriod = 10 * time.Minute
+)
+
+// CooldownTracker type is a thread-safe store of last command invocations
+type CooldownTracker struct {
+	last     map[string]time.Time
+	notified map[string]bool
+	mutex    sync.Mutex
+}
+
+var (
+	cooldowns = CooldownTracker{
+		last:     make(map[string]time.Time),
+		notified: make(map[string]bool),
+	}
+
+	// commands which share cooldown with other command
+	cooldownAliases = map[string]string{
+		"yum": "dnf",
+	}
+
+	defaultCommandCooldowns = map[string]CommandCooldown{
+		"ping":         {User: 30 * time.Second, Chat: 5 * time.Second},
+		"dnf":          {User: time.Minute, Chat: 15 * time.Second, Notify: true},
+		"show_feeds":   {User: time.Minute, Chat: 30 * time.Second},
+		"show_insult":  {User: time.Minute, Chat: 30 * time.Second},
+		"preview_feed": {User: time.Minute, Chat: 15 * time.Second, Notify: true},
+	}
+)
+
+// loadCommandCooldowns reads `cooldowns.<command>.{user,chat,notify}` options, they are merged into defaults of command
+func loadCommandCooldowns() map[string]CommandCooldown {
+	result := make(map[string]CommandCooldown)
+	for cmd, cooldown := range defaultCommandCooldowns {
+		result[cmd] = cooldown
+	}
+
+	for cmd := range viper.GetStringMap("cooldowns") {
+		prefix := fmt.Sprintf("cooldowns.%s.", cmd)
+		cooldown := result[cmd]
+		if viper.IsSet(prefix + "user") {
+			cooldown.User = viper.GetDuration(prefix + "user")
+		}
+		if viper.IsSet(prefix + "chat") {
+			cooldown.Chat = viper.GetDuration(prefix + "chat")
+		}
+		if viper.IsSet(prefix + "notify") {
+			cooldown.Notify = viper.GetBool(prefix + "notify")
+		}
+		result[cmd] = cooldown
+	}
+	return result
+}
+
+// cooldownSweep periodically removes invocations which are older than the longest cooldown
+func cooldownSweep() {
+	for {
+		time.Sleep(cooldownSweepPeriod)
+
+		var longest time.Duration
+		for _, cooldown := range options.CommandCooldowns {
+			if cooldown.User > longest {
+				longest = cooldown.User
+			}
+			if cooldown.Chat > longest {
+				longest = cooldown.Chat
+			}
+		}
+		if count := cooldowns.Sweep(longest); count > 0 {
+			log.Debugf("%d expired command invocations removed", count)
+		}
+	}
+}
+
+// Sweep function removes invocations older than period, they can't limit commands anymore
+func (ct *CooldownTracker) Sweep(period time.Duration) (count int) {
+	ct.mutex.Lock()
+	defer ct.mutex.Unlock()
+
+	now := time.Now()
+	for key, last := range ct.last {
+		if now.Sub(last) > period {
+			delete(ct.last, key)
+			delete(ct.notified, key)
+			count++
+		}
+	}
+	for key := range ct.notified {
+		if _, ok := ct.last[key]; !ok {
+			delete(ct.notified, key)
+		}
+	}
+	return
+}
+
+// Check function checks cooldowns and registers invocation of command if it allowed.
+// If invocation is not allowed, it returns remaining wait and notify flag for first rejected invocation only.
+func (ct *CooldownTracker) Check(cmd string, cooldown CommandCooldown, chatID int64, userID int) (allowed bool, wait time.Duration, notify bool) {
+	userKey := fmt.Sprintf("%s:user:%d:%d", cmd, chatID, userID)
+	chatKey := fmt.Sprintf("%s:chat:%d", cmd, chatID)
+
+	ct.mutex.Lock()
+	defer ct.mutex.Unlock()
+
+	now := time.Now()
+	remaining := func(key string, period time.Duration) time.Duration {
+		if last, ok := ct.last[key]; ok && period > 0 {
+			return period - now.Sub(last)
+		}
+		return 0
+	}
+
+	key := userKey
+	wait = remaining(userKey, cooldown.User)
+	if chatWait := remaining(chatKey, cooldown.Chat); chatWait > wait {
+		key = chatKey
+		wait = chatWait
+	}
+
+	if wait > 0 {
+		notify = cooldown.Notify && !ct.notified[key]
+		ct.notified[key] = true
+		return false, wait, notify
+	}
+
+	ct.last[userKey] = now
+	ct.last[chatKey] = now
+	delete(ct.notified, userKey)
+	delete(ct.notified, chatKey)
+	return true, 0, false
+}
+
+func commandsCooldownAllowed(msg *tgbotapi.Message, cmd string) bool {
+	if alias, ok := cooldownAliases[cmd]; ok {
+		cmd = alias
+	}
+	cooldown, ok := options.CommandCooldowns[cmd]
+	if !ok {
+		return true
+	}
+
+	allowed, wait, notify := cooldowns.Check(cmd, cooldown, msg.Chat.ID, msg.From.ID)
+	if allowed {
+		return true
+	}
+
+	log.Debugf("Command `%s` from %s ignored by cooldown, wait %s", cmd, msg.From.String(), wait)
+	if notify {
+		sendMessage(msg.Chat.ID, tr(msg, "cooldown.wait", durationString(wait)), msg.MessageID)
+	}
+	return false
+}
@@ -7,6 +7,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"sort"
 	"strings"
@@ -32,11 +33,67 @@ type Flooder struct {
 
 // Feeder type for store RSS/Atom feeds in database
 type Feeder struct {
-	URL  string `sql:",pk"`
-	Name string
+	URL          string `sql:",pk"`
+	Name         string
+	ETag         string `sql:"etag"`
+	LastModified string
+	ErrorCount   int
+	Unchanged    int
+	NextUpdate   time.Time
+	UpdatePeriod time.Duration
+	LastAttempt  time.Time
+	LastSuccess  time.Time
+	LastError    string
+	ItemCount    int
+	NewCount     int
+	Disabled     bool
+	Categories   []string
 }
 
-// FeedNews type for store news from feeds in database
+// FeedSubscription type for store subscriptions of chats to feeds in database
+type FeedSubscription struct {
+	FeedURL    string `sql:",pk"`
+	ChatID     int64  `sql:",pk"`
+	AddedBy    int
+	CreatedAt  time.Time
+	Delivered  int
+	Suppressed int
+	Mode       string
+	DigestTime string
+	LastDigest time.Time
+	Notify     bool
+	Category   string
+}
+
+// CategorySubscription type for store subscriptions of chats to all feeds of category in database
+type CategorySubscription struct {
+	Category  string `sql:",pk"`
+	ChatID    int64  `sql:",pk"`
+	AddedBy   int
+	CreatedAt time.Time
+}
+
+// FeedDigestItem type for store news queued for digest of subscription in database
+type FeedDigestItem struct {
+	ID        int64
+	FeedURL   string
+	ChatID    int64
+	NewsURL   string
+	NewsGUID  string
+	CreatedAt time.Time
+}
+
+// FeedFilter type for store include and exclude rules of feed subscriptions in database
+type FeedFilter struct {
+	ID      int64
+	FeedURL string
+	ChatID  int64
+	Exclude bool
+	IsRegex bool
+	Pattern string
+}
+
+// FeedNews type for store news from feeds in database, URL is feed URL and GUID is deduplication key of item
 type FeedNews struct {
 	URL         string `sql:",pk"`
 	GUID        string `sql:",pk"`
@@ -46,6 +103,26 @@ type FeedNews struct {
 	ImageTitle  string
 	Description string
 	FeedTitle   string
+	Author      string
+	Published   time.Time
+	Categories  []string
+	Enclosures  []FeedEnclosure
+	CreatedAt   time.Time
+	LastSeen    time.Time
+}
+
+// FeedEnclosure type for store enclosures of news, it is stored in FeedNews as JSON
+type FeedEnclosure struct {
+	URL    string
+	Type   string
+	Length string
+}
+
+// FeedTemplate type for store message templates in database, empty FeedURL means all feeds and zero ChatID means all chats
+type FeedTemplate struct {
+	FeedURL  string `sql:",pk,notnull"`
+	ChatID   int64  `sql:",pk,notnull"`
+	Template string
 }
 
 // InsultWord type for store insult target and words in database
@@ -54,20 +131,135 @@ type InsultWord struct {
 	IsWord bool
 }
 
+// BlockedUser type for store blocklisted users and their hits in database
+type BlockedUser struct {
+	UserID    int `sql:",pk"`
+	Comment   string
+	Active    bool
+	Hits      int
+	LastHit   time.Time
+	UpdatedAt time.Time
+}
+
+// FloodVote type for store flood votes in database, used as evidence for appeals
+type FloodVote struct {
+	ID        int64
+	ChatID    int64
+	FlooderID int
+	VoterID   int
+	VoterName string
+	MessageID int
+	Text      string
+	AppealID  int64
+	Timestamp time.Time
+}
+
+// FloodAppeal type for store appeals of kicked flooders in database
+type FloodAppeal struct {
+	ID           int64
+	ChatID       int64
+	ChatTitle    string
+	ChatUserName string
+	UserID       int
+	UserName     string
+	Status       string
+	ResolvedBy   int
+	CreatedAt    time.Time
+	ResolvedAt   time.Time
+}
+
+// ChatSettings type for store per-chat settings and policies in database
+type ChatSettings struct {
+	ChatID          int64 `sql:",pk"`
+	Timezone        string
+	SlowModeSeconds int
+	NightMode       bool
+	NightModeStart  int
+	NightModeEnd    int
+	QuietHours      bool
+	QuietStart      int
+	QuietEnd        int
+	QuietDigest     bool
+	Language        string
+}
+
+// UserRole type for store granted user roles in database, ChatID is 0 for global roles
+type UserRole struct {
+	UserID int   `sql:",pk"`
+	ChatID int64 `sql:",pk,notnull"`
+	Role   string
+}
+
 var (
 	db *pg.DB
 
+	// columns added after tables were created by previous versions
+	tableMigrations = []string{
+		`ALTER TABLE feeders ADD COLUMN IF NOT EXISTS etag text`,
+		`ALTER TABLE feeders ADD COLUMN IF NOT EXISTS last_modified text`,
+		`ALTER TABLE feeders ADD COLUMN IF NOT EXISTS error_count bigint`,
+		`ALTER TABLE feeders ADD COLUMN IF NOT EXISTS unchanged bigint`,
+		`ALTER TABLE feeders ADD COLUMN IF NOT EXISTS next_update timestamptz`,
+		`ALTER TABLE feeders ADD COLUMN IF NOT EXISTS update_period bigint`,
+		`ALTER TABLE feeders ADD COLUMN IF NOT EXISTS last_attempt timestamptz`,
+		`ALTER TABLE feeders ADD COLUMN IF NOT EXISTS last_success timestamptz`,
+		`ALTER TABLE feeders ADD COLUMN IF NOT EXISTS last_error text`,
+		`ALTER TABLE feeders ADD COLUMN IF NOT EXISTS item_count bigint`,
+		`ALTER TABLE feeders ADD COLUMN IF NOT EXISTS new_count bigint`,
+		`ALTER TABLE feeders ADD COLUMN IF NOT EXISTS disabled boolean`,
+		`ALTER TABLE feeders ADD COLUMN IF NOT EXISTS categories jsonb`,
+		`ALTER TABLE feed_subscriptions ADD COLUMN IF NOT EXISTS delivered bigint`,
+		`ALTER TABLE feed_subscriptions ADD COLUMN IF NOT EXISTS suppressed bigint`,
+		`ALTER TABLE feed_subscriptions ADD COLUMN IF NOT EXISTS mode text`,
+		`ALTER TABLE feed_subscriptions ADD COLUMN IF NOT EXISTS digest_time text`,
+		`ALTER TABLE feed_subscriptions ADD COLUMN IF NOT EXISTS last_digest timestamptz`,
+		`ALTER TABLE feed_subscriptions ADD COLUMN IF NOT EXISTS notify boolean`,
+		`ALTER TABLE feed_subscriptions ADD COLUMN IF NOT EXISTS category text`,
+		`ALTER TABLE chat_settings ADD COLUMN IF NOT EXISTS quiet_hours boolean`,
+		`ALTER TABLE chat_settings ADD COLUMN IF NOT EXISTS quiet_start bigint`,
+		`ALTER TABLE chat_settings ADD COLUMN IF NOT EXISTS quiet_end bigint`,
+		`ALTER TABLE chat_settings ADD COLUMN IF NOT EXISTS quiet_digest boolean`,
+		`ALTER TABLE chat_settings ADD COLUMN IF NOT EXISTS language text`,
+		`ALTER TABLE feed_news ADD COLUMN IF NOT EXISTS last_seen timestamptz`,
+		`ALTER TABLE feed_news ADD COLUMN IF NOT EXISTS author text`,
+		`ALTER TABLE feed_news ADD COLUMN IF NOT EXISTS published timestamptz`,
+		`ALTER TABLE feed_news ADD COLUMN IF NOT EXISTS categories jsonb`,
+		`ALTER TABLE feed_news ADD COLUMN IF NOT EXISTS enclosures jsonb`,
+		`ALTER TABLE feed_news ADD COLUMN IF NOT EXISTS created_at timestamptz`,
+		`UPDATE feed_news SET created_at = now() WHERE created_at IS NULL`,
+		`CREATE INDEX IF NOT EXISTS feed_news_link_idx ON feed_news (link)`,
+		`CREATE INDEX IF NOT EXISTS feed_news_created_at_idx ON feed_news (created_at)`,
+	}
+
 	// ErrorFeedAlreadyExists is a generic error for feed already exists in database message
 	ErrorFeedAlreadyExists = fmt.Errorf("feed already exists in database")
 
+	// ErrorSubscriptionAlreadyExists is a generic error for chat already subscribed to feed message
+	ErrorSubscriptionAlreadyExists = fmt.Errorf("chat already subscribed to feed")
+
 	// ErrorWordAlreadyExists is a generic error for insult word or target already exists in database message
 	ErrorWordAlreadyExists = fmt.Errorf("insult word or target already exists in database")
 
 	// ErrorFeedNotFound is a generic error for a feed not found in database message
 	ErrorFeedNotFound = fmt.Errorf("feed not found in database")
 
+	// ErrorSubscriptionNotFound is a generic error for a feed subscription not found in database message
+	ErrorSubscriptionNotFound = fmt.Errorf("feed subscription not found in database")
+
+	// ErrorFilterNotFound is a generic error for a feed filter not found in database message
+	ErrorFilterNotFound = fmt.Errorf("feed filter not found in database")
+
+	// ErrorTemplateNotFound is a generic error for a feed template not found in database message
+	ErrorTemplateNotFound = fmt.Errorf("feed template not found in database")
+
 	// ErrorWordNotFound is a generic error for a insult word or target not found in database message
 	ErrorWordNotFound = fmt.Errorf("insult word or target not found in database")
+
+	// ErrorRoleNotFound is a generic error for a user role not found in database message
+	ErrorRoleNotFound = fmt.Errorf("user role not found in database")
+
+	// ErrorAppealNotFound is a generic error for a flood appeal not found in database message
+	ErrorAppealNotFound = fmt.Errorf("flood appeal not found in database")
 )
 
 // InitDatabase function for initialize pgsql database
@@ -79,10 +271,32 @@ func InitDatabase() (err error) {
 	}
 	log.Debugf("Try to connect to postgrsql server...")
 	db = pg.Connect(pgo)
-	err = createTables()
+
+	// subscriptions are migrated only once, when table of subscriptions is created
+	var subscriptionsExist bool
+	if subscriptionsExist, err = dbTableExists("feed_subscriptions"); err != nil {
+		return
+	}
+	if err = createTables(); err != nil {
+		return
+	}
+	if err = migrateTables(); err != nil {
+		return
+	}
+	if !subscriptionsExist {
+		err = dbMigrateFeedSubscriptions()
+	}
 	return
 }
 
+func dbTableExists(name string) (exists bool, err error) {
+	var tables []string
+	if _, err = db.Query(&tables, `SELECT table_name FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?`, name); err != nil {
+		return
+	}
+	return len(tables) > 0, nil
+}
+
 func dbSaveChat(chat *tgbotapi.Chat) (err error) {
 	tempChat := &tgbotapi.Chat{ID: chat.ID}
 	if err = db.Select(tempChat); err != nil && err == pg.ErrNoRows {
@@ -124,7 +338,17 @@ func createTables() (err error) {
 		&Cache{},
 		&Feeder{},
 		&FeedNews{},
+		&FeedSubscription{},
+		&CategorySubscription{},
+		&FeedFilter{},
+		&FeedTemplate{},
+		&FeedDigestItem{},
 		&InsultWord{},
+		&BlockedUser{},
+		&FloodVote{},
+		&FloodAppeal{},
+		&ChatSettings{},
+		&UserRole{},
 	}
 
 	for _, t := range tables {
@@ -135,11 +359,30 @@ func createTables() (err error) {
 	return
 }
 
+func migrateTables() (err error) {
+	for _, query := range tableMigrations {
+		if _, err = db.Exec(query); err != nil {
+			return fmt.Errorf("unable to migrate table with [%s]: %s", query, err)
+		}
+	}
+	return
+}
+
 func getChats() (chats []tgbotapi.Chat, err error) {
 	err = db.Model(&chats).Select()
 	return
 }
 
+func dbChatExists(chatID int64) (exists bool, err error) {
+	chat := tgbotapi.Chat{ID: chatID}
+	if err = db.Select(&chat); err != nil && err != pg.ErrNoRows {
+		return
+	} else if err == pg.ErrNoRows {
+		return false, nil
+	}
+	return true, nil
+}
+
 func getChatYears(chatID int64) (years []string, err error) {
 	var intyears []int
 	if _, err = db.Query(&intyears, `SELECT date_part('year', to_timestamp("date")) FROM messages WHERE chat @> '{"id": ?}'`, chatID); err != nil {
@@ -228,7 +471,7 @@ func getUser(name string) (user *tgbotapi.User, err error) {
 		for _, u := range tuser {
 			us = append(us, fmt.Sprintf("@%s (%s %s)", u.UserName, u.FirstName, u.LastName))
 		}
-		text := fmt.Sprintf("``` Список: \n\t%s ```", strings.Join(us, "\n\t"))
+		text := fmt.Sprintf("Список: \n\t%s", strings.Join(us, "\n\t"))
 		log.Warn(text)
 		return nil, fmt.Errorf("%s", text)
 	}
@@ -236,6 +479,15 @@ func getUser(name string) (user *tgbotapi.User, err error) {
 	return &tuser[0], nil
 }
 
+// userNameByID returns name of user from database or user ID if user is unknown
+func userNameByID(userID int) string {
+	user := &tgbotapi.User{ID: userID}
+	if err := db.Select(user); err != nil {
+		return fmt.Sprintf("%d", userID)
+	}
+	return user.String()
+}
+
 func getFileFromCache(fileID string) (file FileCache, err error) {
 	file.FileID = fileID
 	err = db.Select(&file)
@@ -307,6 +559,96 @@ func dbGetFloodLevel(userID int) (level int, err error) {
 	return
 }
 
+func dbAddFloodVote(vote FloodVote) (err error) {
+	err = db.Insert(&vote)
+	return
+}
+
+// dbAddFloodAppeal stores a new appeal and binds to it all votes against user in chat without appeal yet
+func dbAddFloodAppeal(appeal *FloodAppeal) (err error) {
+	if err = db.Insert(appeal); err != nil {
+		return
+	}
+	_, err = db.Model(&FloodVote{}).Set("appeal_id = ?", appeal.ID).Where("chat_id = ? AND flooder_id = ? AND appeal_id IS NULL", appeal.ChatID, appeal.UserID).Update()
+	return
+}
+
+func dbGetFloodAppeal(id int64) (appeal FloodAppeal, err error) {
+	appeal.ID = id
+	if err = db.Select(&appeal); err != nil && err == pg.ErrNoRows {
+		err = ErrorAppealNotFound
+	}
+	return
+}
+
+// dbSetFloodAppealStatus updates status of appeal only if it is still in status from, it returns false if status
+// was changed by someone else
+func dbSetFloodAppealStatus(appeal *FloodAppeal, from string) (updated bool, err error) {
+	var res orm.Result
+	if res, err = db.Model(appeal).Column("status", "resolved_by", "resolved_at").WherePK().Where("status = ?", from).Update(); err != nil {
+		return
+	}
+	return res.RowsAffected() == 1, nil
+}
+
+func dbGetFloodAppealVotes(appealID int64) (votes []FloodVote, err error) {
+	err = db.Model(&votes).Where("appeal_id = ?", appealID).Order("timestamp").Select()
+	return
+}
+
+func dbGetChatSettings(chatID int64) (settings ChatSettings, err error) {
+	settings.ChatID = chatID
+	if err = db.Select(&settings); err != nil && err == pg.ErrNoRows {
+		return settings, nil
+	}
+	return
+}
+
+func dbSaveChatSettings(settings ChatSettings) (err error) {
+	stored := ChatSettings{ChatID: settings.ChatID}
+	if err = db.Select(&stored); err != nil && err != pg.ErrNoRows {
+		return
+	} else if err == pg.ErrNoRows {
+		err = db.Insert(&settings)
+		return
+	}
+	err = db.Update(&settings)
+	return
+}
+
+func dbGetUserRoles(userID int, chatID int64) (roles []UserRole, err error) {
+	err = db.Model(&roles).Where("user_id = ? AND chat_id IN (0, ?)", userID, chatID).Select()
+	return
+}
+
+func dbGetChatRoles(chatID int64) (roles []UserRole, err error) {
+	err = db.Model(&roles).Where("chat_id IN (0, ?)", chatID).Order("chat_id", "user_id").Select()
+	return
+}
+
+func dbSetUserRole(role UserRole) (err error) {
+	stored := UserRole{UserID: role.UserID, ChatID: role.ChatID}
+	if err = db.Select(&stored); err != nil && err != pg.ErrNoRows {
+		return
+	} else if err == pg.ErrNoRows {
+		err = db.Insert(&role)
+		return
+	}
+	err = db.Update(&role)
+	return
+}
+
+func dbDelUserRole(userID int, chatID int64) (err error) {
+	role := UserRole{UserID: userID, ChatID: chatID}
+	if err = db.Select(&role); err != nil && err != pg.ErrNoRows {
+		return
+	} else if err == pg.ErrNoRows {
+		return ErrorRoleNotFound
+	}
+	err = db.Delete(&role)
+	return
+}
+
 func dbAddFeed(url string, name string) (err error) {
 	if _, err = dbGetFeed(url); err != nil && err != pg.ErrNoRows {
 		return
@@ -332,11 +674,327 @@ func dbDelFeed(url string) (err error) {
 	return
 }
 
+func dbFeedExists(url string) (exists bool, err error) {
+	if _, err = dbGetFeed(url); err != nil && err != pg.ErrNoRows {
+		return
+	} else if err == pg.ErrNoRows {
+		return false, nil
+	}
+	return true, nil
+}
+
+// dbUpdateFeedPoll updates only state of feed which is changed by poll, other columns can be changed by commands
+// while feed is polled. Disabled flag is written only when poll disables feed, so it never enables feed back.
+func dbUpdateFeedPoll(feed *Feeder) (err error) {
+	q := db.Model(feed).
+		Column("etag", "last_modified", "error_count", "unchanged", "next_update").
+		Column("last_attempt", "last_success", "last_error", "item_count", "new_count")
+	if feed.Disabled {
+		q = q.Column("disabled")
+	}
+	_, err = q.WherePK().Update()
+	return
+}
+
+func dbEnableFeed(feed *Feeder) (err error) {
+	_, err = db.Model(feed).Column("disabled", "error_count", "next_update").WherePK().Update()
+	return
+}
+
+func dbUpdateFeedPeriod(feed *Feeder) (err error) {
+	_, err = db.Model(feed).Column("update_period", "next_update").WherePK().Update()
+	return
+}
+
 func dbGetAllFeeds() (feeds []Feeder, err error) {
-	err = db.Model(&feeds).Select()
+	err = db.Model(&feeds).Order("name").Select()
+	return
+}
+
+func dbGetChatFeeds(chatID int64) (feeds []Feeder, err error) {
+	err = db.Model(&feeds).Where("url IN (SELECT feed_url FROM feed_subscriptions WHERE chat_id = ?)", chatID).Order("name").Select()
+	return
+}
+
+func dbUpdateFeedCategories(feed *Feeder) (err error) {
+	_, err = db.Model(feed).Column("categories").WherePK().Update()
+	return
+}
+
+func dbGetCategoryFeeds(category string) (feeds []Feeder, err error) {
+	var data []byte
+	if data, err = json.Marshal([]string{category}); err != nil {
+		return
+	}
+	err = db.Model(&feeds).Where("categories @> ?::jsonb", string(data)).Order("name").Select()
+	return
+}
+
+// dbFeedNewsCounts returns count of news stored since time for each feed
+func dbFeedNewsCounts(since time.Time) (counts map[string]int, err error) {
+	var rows []struct {
+		URL   string
+		Count int
+	}
+	if _, err = db.Query(&rows, `SELECT url, count(*) AS count FROM feed_news WHERE created_at > ? GROUP BY url`, since); err != nil {
+		return
+	}
+	counts = make(map[string]int)
+	for _, row := range rows {
+		counts[row.URL] = row.Count
+	}
+	return
+}
+
+func dbAddCategorySubscription(sub CategorySubscription) (err error) {
+	stored := CategorySubscription{Category: sub.Category, ChatID: sub.ChatID}
+	if err = db.Select(&stored); err != nil && err != pg.ErrNoRows {
+		return
+	} else if err == nil {
+		return ErrorSubscriptionAlreadyExists
+	}
+	err = db.Insert(&sub)
+	return
+}
+
+func dbDelCategorySubscription(category string, chatID int64) (err error) {
+	sub := CategorySubscription{Category: category, ChatID: chatID}
+	if err = db.Select(&sub); err != nil && err != pg.ErrNoRows {
+		return
+	} else if err == pg.ErrNoRows {
+		return ErrorSubscriptionNotFound
+	}
+	err = db.Delete(&sub)
+	return
+}
+
+func dbGetCategorySubscriptions(category string) (subs []CategorySubscription, err error) {
+	err = db.Model(&subs).Where("category = ?", category).Select()
+	return
+}
+
+func dbGetChatCategorySubscriptions(chatID int64) (subs []CategorySubscription, err error) {
+	err = db.Model(&subs).Where("chat_id = ?", chatID).Order("category").Select()
+	return
+}
+
+// dbGetCategoryFeedSubscriptions returns feed subscriptions created by subscription to category
+func dbGetCategoryFeedSubscriptions(category string) (subs []FeedSubscription, err error) {
+	err = db.Model(&subs).Where("category = ?", category).Select()
+	return
+}
+
+func dbAddFeedSubscription(sub FeedSubscription) (err error) {
+	stored := FeedSubscription{FeedURL: sub.FeedURL, ChatID: sub.ChatID}
+	if err = db.Select(&stored); err != nil && err != pg.ErrNoRows {
+		return
+	} else if err == nil {
+		return ErrorSubscriptionAlreadyExists
+	}
+	err = db.Insert(&sub)
+	return
+}
+
+func dbDelFeedSubscription(url string, chatID int64) (err error) {
+	sub := FeedSubscription{FeedURL: url, ChatID: chatID}
+	if err = db.Select(&sub); err != nil && err != pg.ErrNoRows {
+		return
+	} else if err == pg.ErrNoRows {
+		return ErrorSubscriptionNotFound
+	}
+	if err = db.Delete(&sub); err != nil {
+		return
+	}
+	err = dbDelFeedDigestItems(url, chatID)
+	return
+}
+
+func dbGetFeedSubscriptions(url string) (subs []FeedSubscription, err error) {
+	err = db.Model(&subs).Where("feed_url = ?", url).Select()
+	return
+}
+
+func dbGetFeedSubscription(url string, chatID int64) (sub FeedSubscription, err error) {
+	sub = FeedSubscription{FeedURL: url, ChatID: chatID}
+	if err = db.Select(&sub); err != nil && err == pg.ErrNoRows {
+		err = ErrorSubscriptionNotFound
+	}
+	return
+}
+
+func dbGetChatFeedSubscriptions(chatID int64) (subs []FeedSubscription, err error) {
+	err = db.Model(&subs).Where("chat_id = ?", chatID).Order("feed_url").Select()
+	return
+}
+
+// dbFeedSubscriptionCount increments delivered or suppressed items counter of subscription
+func dbFeedSubscriptionCount(url string, chatID int64, suppressed bool) (err error) {
+	column := "delivered"
+	if suppressed {
+		column = "suppressed"
+	}
+	_, err = db.Model(&FeedSubscription{}).Set(fmt.Sprintf("%s = COALESCE(%s, 0) + 1", column, column)).Where("feed_url = ? AND chat_id = ?", url, chatID).Update()
+	return
+}
+
+// dbUpdateFeedSubscriptionMode updates delivery mode columns only, counters are updated concurrently by delivery
+func dbUpdateFeedSubscriptionMode(sub *FeedSubscription) (err error) {
+	_, err = db.Model(sub).Column("mode", "digest_time", "last_digest", "notify").WherePK().Update()
+	return
+}
+
+// dbGetHeldSubscriptions returns subscriptions without digest mode which have news held by quiet hours
+func dbGetHeldSubscriptions() (subs []FeedSubscription, err error) {
+	err = db.Model(&subs).
+		Where("mode IS NULL OR mode NOT IN (?, ?)", feedModeHourly, feedModeDaily).
+		Where("EXISTS (SELECT 1 FROM feed_digest_items AS fdi WHERE fdi.feed_url = feed_subscription.feed_url AND fdi.chat_id = feed_subscription.chat_id)").
+		Select()
+	return
+}
+
+// dbGetDigestSubscriptions returns subscriptions with digest delivery mode
+func dbGetDigestSubscriptions() (subs []FeedSubscription, err error) {
+	err = db.Model(&subs).Where("mode IN (?, ?)", feedModeHourly, feedModeDaily).Select()
 	return
 }
 
+func dbAddFeedDigestItem(item FeedDigestItem) (err error) {
+	err = db.Insert(&item)
+	return
+}
+
+// dbGetFeedDigestNews returns news queued for digest of subscription in order of queueing and IDs of queued items
+// of these news, only these items should be deleted after sending as new items can be queued meanwhile
+func dbGetFeedDigestNews(url string, chatID int64) (news []FeedNews, ids []int64, err error) {
+	var (
+		items []FeedDigestItem
+		found []FeedNews
+	)
+	if err = db.Model(&items).Where("feed_url = ? AND chat_id = ?", url, chatID).Order("id").Select(); err != nil || len(items) == 0 {
+		return
+	}
+	if err = db.Model(&found).
+		Join("JOIN feed_digest_items AS fdi ON fdi.news_url = feed_news.url AND fdi.news_guid = feed_news.guid").
+		Where("fdi.feed_url = ? AND fdi.chat_id = ?", url, chatID).
+		Select(); err != nil {
+		return
+	}
+
+	byKey := make(map[[2]string]FeedNews)
+	for _, n := range found {
+		byKey[[2]string{n.URL, n.GUID}] = n
+	}
+	for _, item := range items {
+		if n, ok := byKey[[2]string{item.NewsURL, item.NewsGUID}]; ok {
+			news = append(news, n)
+			ids = append(ids, item.ID)
+		}
+	}
+	return
+}
+
+func dbDelFeedDigestItems(url string, chatID int64) (err error) {
+	_, err = db.Model(&FeedDigestItem{}).Where("feed_url = ? AND chat_id = ?", url, chatID).Delete()
+	return
+}
+
+func dbDelFeedDigestItemsByID(ids []int64) (err error) {
+	if len(ids) == 0 {
+		return
+	}
+	_, err = db.Model(&FeedDigestItem{}).Where("id IN (?)", pg.In(ids)).Delete()
+	return
+}
+
+func dbAddFeedFilter(filter *FeedFilter) (err error) {
+	err = db.Insert(filter)
+	return
+}
+
+func dbDelFeedFilter(id int64, chatID int64) (err error) {
+	var res orm.Result
+	if res, err = db.Model(&FeedFilter{}).Where("id = ? AND chat_id = ?", id, chatID).Delete(); err != nil {
+		return
+	}
+	if res.RowsAffected() == 0 {
+		err = ErrorFilterNotFound
+	}
+	return
+}
+
+func dbGetFeedFilters(url string) (filters []FeedFilter, err error) {
+	err = db.Model(&filters).Where("feed_url = ?", url).Order("id").Select()
+	return
+}
+
+func dbGetChatFeedFilters(chatID int64) (filters []FeedFilter, err error) {
+	err = db.Model(&filters).Where("chat_id = ?", chatID).Order("feed_url", "id").Select()
+	return
+}
+
+// dbGetFeedTemplates returns templates of feed for all chats including global ones
+func dbGetFeedTemplates(url string) (templates []FeedTemplate, err error) {
+	err = db.Model(&templates).Where("feed_url IN ('', ?)", url).Select()
+	return
+}
+
+// dbGetChatFeedTemplates returns templates which may be used in chat
+func dbGetChatFeedTemplates(chatID int64) (templates []FeedTemplate, err error) {
+	err = db.Model(&templates).Where("chat_id IN (0, ?)", chatID).Order("chat_id", "feed_url").Select()
+	return
+}
+
+func dbSetFeedTemplate(tmpl FeedTemplate) (err error) {
+	stored := FeedTemplate{FeedURL: tmpl.FeedURL, ChatID: tmpl.ChatID}
+	if err = db.Select(&stored); err != nil && err != pg.ErrNoRows {
+		return
+	} else if err == pg.ErrNoRows {
+		err = db.Insert(&tmpl)
+		return
+	}
+	err = db.Update(&tmpl)
+	return
+}
+
+func dbDelFeedTemplate(url string, chatID int64) (err error) {
+	tmpl := FeedTemplate{FeedURL: url, ChatID: chatID}
+	if err = db.Select(&tmpl); err != nil && err != pg.ErrNoRows {
+		return
+	} else if err == pg.ErrNoRows {
+		return ErrorTemplateNotFound
+	}
+	err = db.Delete(&tmpl)
+	return
+}
+
+// dbMigrateFeedSubscriptions subscribes all group chats and channels to feeds without subscriptions,
+// as all feeds were sent to all chats before subscriptions. It is called only when table of subscriptions is created.
+func dbMigrateFeedSubscriptions() (err error) {
+	var (
+		feeds []Feeder
+		chats []tgbotapi.Chat
+	)
+	if err = db.Model(&feeds).Where("url NOT IN (SELECT feed_url FROM feed_subscriptions)").Select(); err != nil || len(feeds) == 0 {
+		return
+	}
+	if chats, err = getChats(); err != nil {
+		return
+	}
+
+	for _, feed := range feeds {
+		for _, chat := range chats {
+			if !chat.IsGroup() && !chat.IsSuperGroup() && !chat.IsChannel() {
+				continue
+			}
+			if err = dbAddFeedSubscription(FeedSubscription{FeedURL: feed.URL, ChatID: chat.ID, CreatedAt: time.Now()}); err != nil && err != ErrorSubscriptionAlreadyExists {
+				return
+			}
+		}
+		log.Infof("Feed %s subscribed to all chats", feed.URL)
+	}
+	return nil
+}
+
 func dbNewsFound(news FeedNews) bool {
 	if err := db.Select(&news); err != nil && err != pg.ErrNoRows {
 		log.Errorf("Unable to get feed news with URL=%s and GUID=%s: %s", news.URL, news.GUID, err)
@@ -351,6 +1009,45 @@ func dbNewsAdd(news FeedNews) (err error) {
 	return
 }
 
+// dbGetPulseNews returns stored news from newer to older, news are filtered by feed and chat subscriptions if they are set
+func dbGetPulseNews(url string, chatID int64, offset, limit int) (news []FeedNews, err error) {
+	query := db.Model(&news)
+	if url != "" {
+		query = query.Where("url = ?", url)
+	}
+	if chatID != 0 {
+		query = query.Where("url IN (SELECT feed_url FROM feed_subscriptions WHERE chat_id = ?)", chatID)
+	}
+	err = query.Order("created_at DESC", "guid").Offset(offset).Limit(limit).Select()
+	return
+}
+
+// dbNewsLinkFound checks news with link in all feeds
+func dbNewsLinkFound(link string) bool {
+	count, err := db.Model(&FeedNews{}).Where("link = ?", link).Count()
+	if err != nil {
+		log.Errorf("Unable to get feed news with link %s: %s", link, err)
+	}
+	return count > 0
+}
+
+// dbNewsTouch stores time when news are seen in feed last time, time of storing is kept for order of news
+func dbNewsTouch(url string, guids []string) (err error) {
+	_, err = db.Model(&FeedNews{}).Set("last_seen = ?", time.Now()).Where("url = ? AND guid IN (?)", url, pg.In(guids)).Update()
+	return
+}
+
+// dbNewsPrune deletes news stored (or seen in feed last time) before time and digest items queued before it
+func dbNewsPrune(before time.Time) (count int, err error) {
+	var res orm.Result
+	if res, err = db.Model(&FeedNews{}).Where("COALESCE(last_seen, created_at) < ?", before).Delete(); err != nil {
+		return
+	}
+	count = res.RowsAffected()
+	_, err = db.Model(&FeedDigestItem{}).Where("created_at < ?", before).Delete()
+	return
+}
+
 func dbInsultFoundWordOrTarget(word string, isWord bool) bool {
 	t := &InsultWord{Word: word, IsWord: isWord}
 	if err := db.Select(t); err != nil && err == pg.ErrNoRows {
@@ -390,3 +1087,40 @@ func dbInsultDelWordOrTarget(word string, isWord bool) (err error) {
 	err = db.Delete(&InsultWord{Word: word, IsWord: isWord})
 	return
 }
+
+func dbBlocklistImport(users []BlockedUser) (err error) {
+	now := time.Now()
+	for _, user := range users {
+		stored := BlockedUser{UserID: user.UserID}
+		if err = db.Select(&stored); err != nil && err != pg.ErrNoRows {
+			return
+		} else if err == pg.ErrNoRows {
+			user.Active = true
+			user.UpdatedAt = now
+			if err = db.Insert(&user); err != nil {
+				return
+			}
+			continue
+		}
+		stored.Comment = user.Comment
+		stored.Active = true
+		stored.UpdatedAt = now
+		if err = db.Update(&stored); err != nil {
+			return
+		}
+	}
+
+	// entries removed from the source are kept for stats, but not enforced anymore
+	_, err = db.Model(&BlockedUser{}).Set("active = ?", false).Where("updated_at < ?", now).Update()
+	return
+}
+
+func dbBlocklistGetActive() (users []BlockedUser, err error) {
+	err = db.Model(&users).Where("active = ?", true).Select()
+	return
+}
+
+func dbBlocklistHit(userID int) (err error) {
+	_, err = db.Model(&BlockedUser{}).Set("hits = COALESCE(hits, 0) + 1").Set("last_hit = ?", time.Now()).Where("user_id = ?", userID).Update()
+	return
+}
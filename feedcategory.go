@@ -0,0 +1,182 @@
+// -*- Go -*-
+/* ------------------------------------------------ */
+/* Golang source                                    */
+/* Author: Alexei Panov <me@elemc.name> 			*/
+/* ------------------------------------------------ */
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// feedCategoryName normalizes category name: it is lower case word
+func feedCategoryName(name string) (category string, err error) {
+	category = strings.ToLower(strings.TrimSpace(name))
+	if category == "" || strings.ContainsAny(category, " \t\n") {
+		err = fmt.Errorf("category must be one word")
+	}
+	return
+}
+
+// HasCategory function checks category of feed
+func (feed *Feeder) HasCategory(category string) bool {
+	for _, c := range feed.Categories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// feedCategoryAdd adds category to feed, chats subscribed to category are subscribed to feed
+func feedCategoryAdd(url string, category string) (err error) {
+	var (
+		feed Feeder
+		subs []CategorySubscription
+	)
+	if feed, err = dbGetFeed(url); err != nil {
+		return
+	}
+	if feed.HasCategory(category) {
+		return
+	}
+	feed.Categories = append(feed.Categories, category)
+	sort.Strings(feed.Categories)
+	if err = dbUpdateFeedCategories(&feed); err != nil {
+		return
+	}
+
+	if subs, err = dbGetCategorySubscriptions(category); err != nil {
+		return
+	}
+	for _, sub := range subs {
+		if err = dbAddFeedSubscription(FeedSubscription{
+			FeedURL:   url,
+			ChatID:    sub.ChatID,
+			AddedBy:   sub.AddedBy,
+			CreatedAt: time.Now(),
+			Category:  category,
+		}); err != nil && err != ErrorSubscriptionAlreadyExists {
+			return
+		}
+	}
+	return nil
+}
+
+// feedCategoryDel removes category from feed, subscriptions to feed created by category are removed too
+func feedCategoryDel(url string, category string) (err error) {
+	var (
+		feed       Feeder
+		categories []string
+		subs       []FeedSubscription
+	)
+	if feed, err = dbGetFeed(url); err != nil {
+		return
+	}
+	for _, c := range feed.Categories {
+		if c != category {
+			categories = append(categories, c)
+		}
+	}
+	feed.Categories = categories
+	if err = dbUpdateFeedCategories(&feed); err != nil {
+		return
+	}
+
+	if subs, err = dbGetCategoryFeedSubscriptions(category); err != nil {
+		return
+	}
+	for _, sub := range subs {
+		if sub.FeedURL != url {
+			continue
+		}
+		// feed is kept without subscriptions, its seen news prevent backlog if it is added again
+		if err = dbDelFeedSubscription(sub.FeedURL, sub.ChatID); err != nil && err != ErrorSubscriptionNotFound {
+			return
+		}
+	}
+	return nil
+}
+
+// categorySubscribe subscribes chat to category and all its feeds
+func categorySubscribe(category string, chatID int64, userID int) (count int, err error) {
+	var feeds []Feeder
+	if feeds, err = dbGetCategoryFeeds(category); err != nil {
+		return
+	}
+	if len(feeds) == 0 {
+		err = ErrorFeedNotFound
+		return
+	}
+	if err = dbAddCategorySubscription(CategorySubscription{Category: category, ChatID: chatID, AddedBy: userID, CreatedAt: time.Now()}); err != nil {
+		return
+	}
+
+	for _, feed := range feeds {
+		if err = dbAddFeedSubscription(FeedSubscription{
+			FeedURL:   feed.URL,
+			ChatID:    chatID,
+			AddedBy:   userID,
+			CreatedAt: time.Now(),
+			Category:  category,
+		}); err == ErrorSubscriptionAlreadyExists {
+			continue
+		} else if err != nil {
+			return
+		}
+		count++
+	}
+	return count, nil
+}
+
+// categoryUnsubscribe unsubscribes chat from category and feeds subscribed by it, feeds are kept in database
+func categoryUnsubscribe(category string, chatID int64) (err error) {
+	var subs []FeedSubscription
+	if err = dbDelCategorySubscription(category, chatID); err != nil {
+		return
+	}
+	if subs, err = dbGetCategoryFeedSubscriptions(category); err != nil {
+		return
+	}
+	for _, sub := range subs {
+		if sub.ChatID != chatID {
+			continue
+		}
+		if err = dbDelFeedSubscription(sub.FeedURL, sub.ChatID); err != nil && err != ErrorSubscriptionNotFound {
+			log.Errorf("Unable to unsubscribe chat %d from feed %s: %s", chatID, sub.FeedURL, err)
+		}
+	}
+	return nil
+}
+
+// feedsByCategory groups feeds by categories, feed may be in several groups. Feeds without category are grouped
+// with empty category, it is the last one.
+func feedsByCategory(feeds []Feeder) (categories []string, groups map[string][]Feeder) {
+	groups = make(map[string][]Feeder)
+	for _, feed := range feeds {
+		if len(feed.Categories) == 0 {
+			groups[""] = append(groups[""], feed)
+			continue
+		}
+		for _, category := range feed.Categories {
+			groups[category] = append(groups[category], feed)
+		}
+	}
+
+	for category := range groups {
+		if category != "" {
+			categories = append(categories, category)
+		}
+	}
+	sort.Strings(categories)
+	if _, ok := groups[""]; ok {
+		categories = append(categories, "")
+	}
+	return
+}
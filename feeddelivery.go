@@ -0,0 +1,103 @@
+// -*- Go -*-
+/* ------------------------------------------------ */
+/* Golang source                                    */
+/* Author: Alexei Panov <me@elemc.name> 			*/
+/* ------------------------------------------------ */
+
+package main
+
+import (
+	"time"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+// FeedDelivery is a type for store subscriptions, filters and templates of feed while news are delivered
+type FeedDelivery struct {
+	URL       string
+	Subs      []FeedSubscription
+	Filters   []FeedFilter
+	Templates []FeedTemplate
+}
+
+func newFeedDelivery(url string) (delivery *FeedDelivery, err error) {
+	delivery = &FeedDelivery{URL: url}
+	if delivery.Subs, err = dbGetFeedSubscriptions(url); err != nil {
+		return
+	}
+	if delivery.Filters, err = dbGetFeedFilters(url); err != nil {
+		return
+	}
+	delivery.Templates, err = dbGetFeedTemplates(url)
+	return
+}
+
+// Send function sends news to all subscribed chats with their templates, news suppressed by filters are counted only
+func (delivery *FeedDelivery) Send(news FeedNews) {
+	for _, sub := range delivery.Subs {
+		suppressed := !feedFiltersAllow(delivery.Filters, sub.ChatID, news)
+		if err := dbFeedSubscriptionCount(sub.FeedURL, sub.ChatID, suppressed); err != nil {
+			log.Errorf("Unable to count news of feed %s for chat %d: %s", sub.FeedURL, sub.ChatID, err)
+		}
+		if suppressed {
+			log.Debugf("News [%s] of feed %s suppressed by filters of chat %d", news.Title, sub.FeedURL, sub.ChatID)
+			continue
+		}
+
+		// news for digest and news arrived in quiet hours are queued
+		if sub.IsDigest() || chatQuiet(sub.ChatID) {
+			item := FeedDigestItem{FeedURL: sub.FeedURL, ChatID: sub.ChatID, NewsURL: news.URL, NewsGUID: news.GUID, CreatedAt: time.Now()}
+			if err := dbAddFeedDigestItem(item); err != nil {
+				log.Errorf("Unable to queue news of feed %s for chat %d: %s", sub.FeedURL, sub.ChatID, err)
+			}
+			continue
+		}
+
+		text, err := feedRenderNews(feedTemplateFor(delivery.Templates, delivery.URL, sub.ChatID), news)
+		if err != nil {
+			log.Errorf("Unable to execute template of feed %s for chat %d: %s", delivery.URL, sub.ChatID, err)
+			continue
+		}
+		if text == "" {
+			log.Warnf("Unable to send empty news of feed %s to chat %d", delivery.URL, sub.ChatID)
+			continue
+		}
+		go feedSendNews(sub.ChatID, text, news.Images(), !sub.Notify)
+	}
+}
+
+// feedSendNews sends news as photo or album with caption if news has images. News is sent as text
+// if caption is too long or images can't be sent.
+func feedSendNews(chatID int64, text string, images []string, silent bool) {
+	if len(images) > 0 && utf8.RuneCountInString(text) <= captionMaxLength {
+		var err error
+		if len(images) == 1 {
+			err = sendPhoto(chatID, images[0], text, silent)
+		} else {
+			err = sendMediaGroup(chatID, images, text, silent)
+		}
+		if err == nil {
+			return
+		}
+		log.Warnf("Unable to send images to chat %d, news is sent as text: %s", chatID, err)
+	}
+	feedSendText(chatID, text, silent)
+}
+
+func feedSendText(chatID int64, text string, silent bool) {
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.DisableNotification = silent
+	sendQueuedMessage(msg, OutgoingPriorityLow)
+}
+
+// chatQuiet checks quiet hours of pulse in chat
+func chatQuiet(chatID int64) bool {
+	settings, err := chatSettings.Get(chatID)
+	if err != nil {
+		log.Errorf("Unable to get settings for chat %d: %s", chatID, err)
+		return false
+	}
+	return settings.IsQuiet()
+}
@@ -0,0 +1,252 @@
+// -*- Go -*-
+/* ------------------------------------------------ */
+/* Golang source                                    */
+/* Author: Alexei Panov <me@elemc.name> 			*/
+/* ------------------------------------------------ */
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Delivery modes of feed subscriptions
+const (
+	feedModeImmediate = "immediate"
+	feedModeHourly    = "hourly"
+	feedModeDaily     = "daily"
+
+	feedDigestCheckPeriod = time.Minute
+)
+
+// FeedSendLocks is a type for serialising sends of queued news of subscriptions
+type FeedSendLocks struct {
+	locks map[string]*feedSendLock
+	mutex sync.Mutex
+}
+
+type feedSendLock struct {
+	sync.Mutex
+	waiters int
+}
+
+var (
+	feedSendLocks = FeedSendLocks{locks: make(map[string]*feedSendLock)}
+)
+
+// lock locks subscription and returns function to unlock it, lock is removed when nobody waits for it
+func (fl *FeedSendLocks) lock(sub FeedSubscription) (unlock func()) {
+	key := fmt.Sprintf("%d:%s", sub.ChatID, sub.FeedURL)
+	fl.mutex.Lock()
+	l, ok := fl.locks[key]
+	if !ok {
+		l = &feedSendLock{}
+		fl.locks[key] = l
+	}
+	l.waiters++
+	fl.mutex.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		fl.mutex.Lock()
+		if l.waiters--; l.waiters == 0 {
+			delete(fl.locks, key)
+		}
+		fl.mutex.Unlock()
+	}
+}
+
+func parseFeedMode(s string) (mode string, ok bool) {
+	switch mode = strings.ToLower(strings.TrimSpace(s)); mode {
+	case feedModeImmediate, feedModeHourly, feedModeDaily:
+		return mode, true
+	}
+	return "", false
+}
+
+// parseDigestTime parses time of daily digest in format `09:30`
+func parseDigestTime(s string) (hour, minute int, err error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		err = fmt.Errorf("invalid digest time %s", s)
+		return
+	}
+	if hour, err = strconv.Atoi(parts[0]); err != nil {
+		return
+	}
+	if minute, err = strconv.Atoi(parts[1]); err != nil {
+		return
+	}
+	if hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		err = fmt.Errorf("digest time out of range in %s", s)
+	}
+	return
+}
+
+// IsDigest function returns true if news of subscription are delivered as digest
+func (sub FeedSubscription) IsDigest() bool {
+	return sub.Mode == feedModeHourly || sub.Mode == feedModeDaily
+}
+
+// ModeString function returns delivery mode of subscription for humans
+func (sub FeedSubscription) ModeString(l Locale) string {
+	switch sub.Mode {
+	case feedModeHourly:
+		return l.T("mode.hourly")
+	case feedModeDaily:
+		return l.T("mode.daily", sub.digestTime())
+	}
+	return l.T("mode.immediate")
+}
+
+func (sub FeedSubscription) digestTime() string {
+	if sub.DigestTime != "" {
+		return sub.DigestTime
+	}
+	return options.FeedsDigestTime
+}
+
+// lastDigestOccurrence returns latest scheduled time of digest not after now in chat time zone
+func (sub FeedSubscription) lastDigestOccurrence(now time.Time, location *time.Location) time.Time {
+	local := now.In(location)
+	if sub.Mode == feedModeHourly {
+		return time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), 0, 0, 0, location)
+	}
+
+	hour, minute, err := parseDigestTime(sub.digestTime())
+	if err != nil {
+		log.Warnf("Invalid digest time of feed %s in chat %d: %s", sub.FeedURL, sub.ChatID, err)
+	}
+	occurrence := time.Date(local.Year(), local.Month(), local.Day(), hour, minute, 0, 0, location)
+	if occurrence.After(local) {
+		occurrence = occurrence.AddDate(0, 0, -1)
+	}
+	return occurrence
+}
+
+// feedDigests sends digests of subscriptions when their time comes, digests are postponed by quiet hours of chat.
+// News held by quiet hours are sent when quiet hours end.
+func feedDigests() {
+	defer wg.Done()
+	for {
+		feedReleaseHeld()
+
+		subs, err := dbGetDigestSubscriptions()
+		if err != nil {
+			log.Errorf("Unable to get digest subscriptions: %s", err)
+		}
+
+		now := time.Now()
+		for _, sub := range subs {
+			settings, err := chatSettings.Get(sub.ChatID)
+			if err != nil {
+				log.Errorf("Unable to get settings for chat %d: %s", sub.ChatID, err)
+			}
+			if settings.IsQuiet() || !sub.LastDigest.Before(sub.lastDigestOccurrence(now, settings.Location())) {
+				continue
+			}
+
+			feedDigestSend(sub)
+			sub.LastDigest = now
+			if err = dbUpdateFeedSubscriptionMode(&sub); err != nil {
+				log.Errorf("Unable to update digest time of feed %s in chat %d: %s", sub.FeedURL, sub.ChatID, err)
+			}
+		}
+		time.Sleep(feedDigestCheckPeriod)
+	}
+}
+
+// feedDigestSend sends queued news of subscription as one combined message, it is split if it is too long
+func feedDigestSend(sub FeedSubscription) {
+	unlock := feedSendLocks.lock(sub)
+	defer unlock()
+
+	news, ids, err := dbGetFeedDigestNews(sub.FeedURL, sub.ChatID)
+	if err != nil {
+		log.Errorf("Unable to get digest of feed %s for chat %d: %s", sub.FeedURL, sub.ChatID, err)
+		return
+	}
+	if len(news) == 0 {
+		return
+	}
+
+	title := sub.FeedURL
+	if feed, err := dbGetFeed(sub.FeedURL); err == nil && feed.Name != "" {
+		title = feed.Name
+	}
+
+	text := newText().Bold(title).Plainf(" (%d)", len(news))
+	for _, n := range news {
+		text.Line().Plain("• ").Link(n.Title, n.Link)
+	}
+	feedSendText(sub.ChatID, text.String(), !sub.Notify)
+
+	if err = dbDelFeedDigestItemsByID(ids); err != nil {
+		log.Errorf("Unable to clear digest of feed %s for chat %d: %s", sub.FeedURL, sub.ChatID, err)
+	}
+}
+
+// feedReleaseHeld sends news held by quiet hours in chats where quiet hours are over, news are sent one by one or as digest
+func feedReleaseHeld() {
+	subs, err := dbGetHeldSubscriptions()
+	if err != nil {
+		log.Errorf("Unable to get subscriptions with held news: %s", err)
+		return
+	}
+
+	for _, sub := range subs {
+		settings, err := chatSettings.Get(sub.ChatID)
+		if err != nil {
+			log.Errorf("Unable to get settings for chat %d: %s", sub.ChatID, err)
+			continue
+		}
+		if settings.IsQuiet() {
+			continue
+		}
+		if settings.QuietDigest {
+			feedDigestSend(sub)
+		} else {
+			feedHeldSend(sub)
+		}
+	}
+}
+
+// feedHeldSend sends held news of subscription one by one with templates of chat
+func feedHeldSend(sub FeedSubscription) {
+	unlock := feedSendLocks.lock(sub)
+	defer unlock()
+
+	news, ids, err := dbGetFeedDigestNews(sub.FeedURL, sub.ChatID)
+	if err != nil {
+		log.Errorf("Unable to get held news of feed %s for chat %d: %s", sub.FeedURL, sub.ChatID, err)
+		return
+	}
+	templates, err := dbGetFeedTemplates(sub.FeedURL)
+	if err != nil {
+		log.Errorf("Unable to get templates of feed %s: %s", sub.FeedURL, err)
+		return
+	}
+
+	tmpl := feedTemplateFor(templates, sub.FeedURL, sub.ChatID)
+	sent := 0
+	for _, n := range news {
+		text, err := feedRenderNews(tmpl, n)
+		if err != nil {
+			log.Errorf("Unable to execute template of feed %s for chat %d: %s", sub.FeedURL, sub.ChatID, err)
+			break
+		}
+		feedSendNews(sub.ChatID, text, n.Images(), !sub.Notify)
+		sent++
+	}
+
+	if err = dbDelFeedDigestItemsByID(ids[:sent]); err != nil {
+		log.Errorf("Unable to clear held news of feed %s for chat %d: %s", sub.FeedURL, sub.ChatID, err)
+	}
+}
@@ -0,0 +1,340 @@
+// -*- Go -*-
+/* ------------------------------------------------ */
+/* Golang source                                    */
+/* Author: Alexei Panov <me@elemc.name> 			*/
+/* ------------------------------------------------ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+const (
+	feedUserAgent    = "gotelegrambot (+https://github.com/elemc/gotelegrambot2)"
+	feedMaxRedirects = 10
+)
+
+type feedContextKey int
+
+const (
+	feedPublicOnlyKey feedContextKey = iota
+)
+
+// feedPublicOnly returns context for fetches started by members, only public hosts are connected with it
+// including hosts of redirects
+func feedPublicOnly(ctx context.Context) context.Context {
+	return context.WithValue(ctx, feedPublicOnlyKey, true)
+}
+
+func feedIsPublicOnly(ctx context.Context) bool {
+	publicOnly, _ := ctx.Value(feedPublicOnlyKey).(bool)
+	return publicOnly
+}
+
+// feedFetch downloads and parses feed with conditional request, caching headers are stored in feed.
+// It returns nil feed without error if feed is not modified since last request.
+func feedFetch(ctx context.Context, feed *Feeder) (fd *gofeed.Feed, err error) {
+	var page *FeedPage
+	if page, err = feedDownload(ctx, feed); err != nil || page == nil {
+		return
+	}
+	if fd, err = feedParse(page.Data); err != nil {
+		return
+	}
+	feed.ETag = page.ETag
+	feed.LastModified = page.LastModified
+	return
+}
+
+// FeedPage is a type for downloaded feed or HTML page with caching headers
+type FeedPage struct {
+	Data         []byte
+	ContentType  string
+	ETag         string
+	LastModified string
+}
+
+// feedDownload downloads feed with conditional request, it returns nil page if feed is not modified since last request
+func feedDownload(ctx context.Context, feed *Feeder) (page *FeedPage, err error) {
+	var (
+		req  *http.Request
+		resp *http.Response
+		data []byte
+	)
+
+	if req, err = http.NewRequest("GET", feed.URL, nil); err != nil {
+		return
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("User-Agent", feedUserAgent)
+	if feed.ETag != "" {
+		req.Header.Set("If-None-Match", feed.ETag)
+	}
+	if feed.LastModified != "" {
+		req.Header.Set("If-Modified-Since", feed.LastModified)
+	}
+
+	client := http.Client{Timeout: options.FeedsFetchTimeout}
+	if feedIsPublicOnly(ctx) {
+		if err = feedCheckPublicURL(ctx, feed.URL); err != nil {
+			return
+		}
+		client.Transport = feedPublicTransport()
+		client.CheckRedirect = feedPublicRedirect
+	}
+	if resp, err = client.Do(req); err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	// not modified page is expected only for conditional request, otherwise nil page would be unexpected for caller
+	if resp.StatusCode == http.StatusNotModified && (feed.ETag != "" || feed.LastModified != "") {
+		return nil, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err = fmt.Errorf("unexpected status %s", resp.Status)
+		return
+	}
+
+	if data, err = ioutil.ReadAll(io.LimitReader(resp.Body, options.FeedsMaxSize+1)); err != nil {
+		return
+	}
+	if int64(len(data)) > options.FeedsMaxSize {
+		err = fmt.Errorf("feed is larger than %d bytes", options.FeedsMaxSize)
+		return
+	}
+
+	page = &FeedPage{
+		Data:         data,
+		ContentType:  resp.Header.Get("Content-Type"),
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+	return
+}
+
+// feedParse parses RSS, Atom or JSON feed, error is more precise than gofeed one if feed type is not detected
+func feedParse(data []byte) (fd *gofeed.Feed, err error) {
+	if fd, err = gofeed.NewParser().Parse(bytes.NewReader(data)); err == gofeed.ErrFeedTypeNotDetected {
+		if feedLooksLikeHTML(data) {
+			err = fmt.Errorf("it is HTML page, not RSS, Atom or JSON feed")
+		} else {
+			err = fmt.Errorf("it is not RSS, Atom or JSON feed")
+		}
+	}
+	return
+}
+
+func feedLooksLikeHTML(data []byte) bool {
+	if len(data) > 1024 {
+		data = data[:1024]
+	}
+	head := strings.ToLower(string(data))
+	return strings.Contains(head, "<!doctype html") || strings.Contains(head, "<html")
+}
+
+// feedDiscover fetches feed by URL, if URL is HTML page then feed is searched in its `<link rel="alternate">` tags.
+// It returns URL of found feed. URLs with private and loopback hosts are rejected as any member can ask to discover.
+func feedDiscover(ctx context.Context, pageURL string) (fd *gofeed.Feed, feedURL string, err error) {
+	var page *FeedPage
+	ctx = feedPublicOnly(ctx)
+	if page, err = feedDownload(ctx, &Feeder{URL: pageURL}); err != nil {
+		return
+	}
+	if page == nil {
+		err = fmt.Errorf("unexpected not modified answer")
+		return
+	}
+	if fd, err = feedParse(page.Data); err == nil || !feedLooksLikeHTML(page.Data) {
+		return fd, pageURL, err
+	}
+
+	links := feedAlternateLinks(pageURL, page.Data)
+	if len(links) == 0 {
+		err = fmt.Errorf("it is HTML page without links to feeds")
+		return
+	}
+	for _, link := range links {
+		if fd, err = feedFetch(ctx, &Feeder{URL: link}); err == nil && fd != nil {
+			return fd, link, nil
+		} else if err == nil {
+			err = fmt.Errorf("unexpected not modified answer")
+		}
+	}
+	err = fmt.Errorf("feed %s found in HTML page is invalid: %s", links[len(links)-1], err)
+	return
+}
+
+var (
+	feedPrivateNetworks = feedParseNetworks("10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10", "fc00::/7")
+)
+
+func feedParseNetworks(cidrs ...string) (networks []*net.IPNet) {
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return
+}
+
+// feedPublicTransport returns transport which checks address right before connection,
+// so host can't be resolved to public address on check and to private one on connect
+func feedPublicTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   options.FeedsFetchTimeout,
+		KeepAlive: 30 * time.Second,
+		Control:   feedDialControl,
+	}
+	return &http.Transport{
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: options.FeedsFetchTimeout,
+		DisableKeepAlives:   true,
+	}
+}
+
+func feedDialControl(network, address string, c syscall.RawConn) (err error) {
+	var host string
+	if host, _, err = net.SplitHostPort(address); err != nil {
+		return
+	}
+	if ip := net.ParseIP(host); ip == nil || !feedPublicIP(ip) {
+		return fmt.Errorf("address %s is not public", host)
+	}
+	return
+}
+
+func feedPublicRedirect(req *http.Request, via []*http.Request) (err error) {
+	if len(via) >= feedMaxRedirects {
+		return fmt.Errorf("stopped after %d redirects", feedMaxRedirects)
+	}
+	return feedCheckPublicURL(req.Context(), req.URL.String())
+}
+
+// feedCheckPublicURL returns error if URL is not HTTP one or its host is resolved to private, loopback or link-local address
+func feedCheckPublicURL(ctx context.Context, rawURL string) (err error) {
+	var (
+		u     *url.URL
+		addrs []net.IPAddr
+	)
+	if u, err = url.Parse(rawURL); err != nil {
+		return
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("only HTTP and HTTPS links are supported")
+	}
+	if addrs, err = net.DefaultResolver.LookupIPAddr(ctx, u.Hostname()); err != nil {
+		return
+	}
+	for _, addr := range addrs {
+		if !feedPublicIP(addr.IP) {
+			return fmt.Errorf("host %s is not public", u.Hostname())
+		}
+	}
+	return
+}
+
+func feedPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, network := range feedPrivateNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	feedLinkTagRegexp  = regexp.MustCompile(`(?is)<link\s[^>]*>`)
+	feedLinkAttrRegexp = regexp.MustCompile(`(?is)([a-z-]+)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+
+	feedLinkTypes = map[string]bool{
+		"application/rss+xml":   true,
+		"application/atom+xml":  true,
+		"application/feed+json": true,
+		"application/json":      true,
+	}
+)
+
+// feedAlternateLinks returns absolute URLs of feeds from `<link rel="alternate">` tags of HTML page
+func feedAlternateLinks(pageURL string, data []byte) (links []string) {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return
+	}
+	for _, tag := range feedLinkTagRegexp.FindAllString(string(data), -1) {
+		attrs := make(map[string]string)
+		for _, attr := range feedLinkAttrRegexp.FindAllStringSubmatch(tag, -1) {
+			attrs[strings.ToLower(attr[1])] = html.UnescapeString(attr[2] + attr[3])
+		}
+		if !strings.Contains(strings.ToLower(attrs["rel"]), "alternate") || !feedLinkTypes[strings.ToLower(attrs["type"])] || attrs["href"] == "" {
+			continue
+		}
+		href, err := base.Parse(attrs["href"])
+		if err != nil {
+			continue
+		}
+		links = appendStringToSliceIfNotFound(links, href.String())
+	}
+	return
+}
+
+// Period function returns polling period of feed
+func (feed *Feeder) Period() time.Duration {
+	if feed.UpdatePeriod > 0 {
+		return feed.UpdatePeriod
+	}
+	return options.FeedsUpdatePeriod
+}
+
+// feedScheduleNext sets time of next update of feed. Period is doubled for each failed update in a row
+// and for each two updates in a row without new items, but it can't be greater than maximum backoff.
+// Random jitter up to 10% of period is added to spread updates of feeds in time.
+func feedScheduleNext(feed *Feeder, failed bool, newItems int) {
+	switch {
+	case failed:
+		feed.ErrorCount++
+	case newItems > 0:
+		feed.ErrorCount = 0
+		feed.Unchanged = 0
+	default:
+		feed.ErrorCount = 0
+		feed.Unchanged++
+	}
+
+	shift := feed.ErrorCount
+	if shift == 0 {
+		shift = feed.Unchanged / 2
+	}
+
+	period := feed.Period()
+	delay := period
+	for i := 0; i < shift && delay < options.FeedsMaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > options.FeedsMaxBackoff && options.FeedsMaxBackoff > period {
+		delay = options.FeedsMaxBackoff
+	}
+	delay += time.Duration(rand.Int63n(int64(delay/10) + 1))
+	feed.NextUpdate = time.Now().Add(delay)
+}
@@ -0,0 +1,169 @@
+// -*- Go -*-
+/* ------------------------------------------------ */
+/* Golang source                                    */
+/* Author: Alexei Panov <me@elemc.name> 			*/
+/* ------------------------------------------------ */
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testFeedRSS = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0">
+<channel>
+	<title>Test feed</title>
+	<link>http://example.com/</link>
+	<item>
+		<title>First news</title>
+		<link>http://example.com/1</link>
+		<guid>1</guid>
+	</item>
+</channel>
+</rss>`
+
+// testFeedOptions sets options of fetching and returns function which restores them
+func testFeedOptions(timeout time.Duration, maxSize int64) (restore func()) {
+	saved := options
+	options = &Options{FeedsFetchTimeout: timeout, FeedsMaxSize: maxSize}
+	return func() { options = saved }
+}
+
+func TestFeedFetchTimeout(t *testing.T) {
+	defer testFeedOptions(50*time.Millisecond, 1024*1024)()
+
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	started := time.Now()
+	if _, err := feedFetch(context.Background(), &Feeder{URL: srv.URL}); err == nil {
+		t.Fatalf("feed is fetched from server which does not answer")
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("fetch is finished after %s, timeout is %s", elapsed, options.FeedsFetchTimeout)
+	}
+}
+
+func TestFeedFetchOversize(t *testing.T) {
+	defer testFeedOptions(5*time.Second, 64)()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testFeedRSS))
+	}))
+	defer srv.Close()
+
+	_, err := feedFetch(context.Background(), &Feeder{URL: srv.URL})
+	if err == nil || !strings.Contains(err.Error(), "larger than 64 bytes") {
+		t.Fatalf("oversize feed is not rejected, error is %v", err)
+	}
+}
+
+func TestFeedFetchNotModified(t *testing.T) {
+	defer testFeedOptions(5*time.Second, 1024*1024)()
+
+	const (
+		etag         = `"v1"`
+		lastModified = "Mon, 02 Jan 2006 15:04:05 GMT"
+	)
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.Header.Get("If-None-Match") == etag && r.Header.Get("If-Modified-Since") == lastModified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", lastModified)
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write([]byte(testFeedRSS))
+	}))
+	defer srv.Close()
+
+	feed := &Feeder{URL: srv.URL}
+	fd, err := feedFetch(context.Background(), feed)
+	if err != nil {
+		t.Fatalf("unable to fetch feed: %s", err)
+	}
+	if fd == nil || fd.Title != "Test feed" || len(fd.Items) != 1 {
+		t.Fatalf("feed is parsed wrong: %+v", fd)
+	}
+	if feed.ETag != etag || feed.LastModified != lastModified {
+		t.Fatalf("caching headers are not stored: ETag=%q, Last-Modified=%q", feed.ETag, feed.LastModified)
+	}
+
+	if fd, err = feedFetch(context.Background(), feed); err != nil {
+		t.Fatalf("unable to fetch not modified feed: %s", err)
+	}
+	if fd != nil {
+		t.Errorf("not modified feed is returned: %+v", fd)
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("%d requests are sent, want 2", n)
+	}
+}
+
+func TestFeedFetchUnexpectedNotModified(t *testing.T) {
+	defer testFeedOptions(5*time.Second, 1024*1024)()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotModified)
+	}))
+	defer srv.Close()
+
+	fd, err := feedFetch(context.Background(), &Feeder{URL: srv.URL})
+	if err == nil || !strings.Contains(err.Error(), "304") {
+		t.Fatalf("not modified answer to unconditional request is not rejected, feed is %+v, error is %v", fd, err)
+	}
+}
+
+func TestFeedFetchPublicOnly(t *testing.T) {
+	defer testFeedOptions(5*time.Second, 1024*1024)()
+
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write([]byte(testFeedRSS))
+	}))
+	defer srv.Close()
+
+	if _, err := feedFetch(feedPublicOnly(context.Background()), &Feeder{URL: srv.URL}); err == nil {
+		t.Errorf("feed on loopback host is fetched by member")
+	}
+	if n := atomic.LoadInt32(&requests); n != 0 {
+		t.Errorf("%d requests are sent to loopback host, want 0", n)
+	}
+}
+
+func TestFeedDialControl(t *testing.T) {
+	tests := []struct {
+		address string
+		public  bool
+	}{
+		{"127.0.0.1:80", false},
+		{"10.1.2.3:443", false},
+		{"169.254.169.254:80", false},
+		{"[::1]:80", false},
+		{"[fd00::1]:80", false},
+		{"93.184.216.34:443", true},
+		{"[2606:2800:220:1::1]:443", true},
+	}
+	for _, test := range tests {
+		if err := feedDialControl("tcp", test.address, nil); (err == nil) != test.public {
+			t.Errorf("feedDialControl(%q) = %v, public is %v", test.address, err, test.public)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// -*- Go -*-
+/* ------------------------------------------------ */
+/* Golang source                                    */
+/* Author: Alexei Panov <me@elemc.name> 			*/
+/* ------------------------------------------------ */
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	feedFilterRegexPrefix = "re:"
+)
+
+// RegexpCache type is a thread-safe cache of compiled regular expressions
+type RegexpCache struct {
+	cache map[string]*regexp.Regexp
+	mutex sync.RWMutex
+}
+
+var (
+	feedFilterRegexps = RegexpCache{cache: make(map[string]*regexp.Regexp)}
+)
+
+// Get function returns compiled regular expression from cache or compiles it
+func (rc *RegexpCache) Get(pattern string) (re *regexp.Regexp, err error) {
+	var ok bool
+	rc.mutex.RLock()
+	re, ok = rc.cache[pattern]
+	rc.mutex.RUnlock()
+	if ok {
+		return
+	}
+
+	if re, err = regexp.Compile(pattern); err != nil {
+		return
+	}
+	rc.mutex.Lock()
+	rc.cache[pattern] = re
+	rc.mutex.Unlock()
+	return
+}
+
+// newFeedFilter parses filter rule, pattern with `re:` prefix is a regular expression, otherwise it is a keyword
+func newFeedFilter(url string, chatID int64, kind string, pattern string) (filter FeedFilter, err error) {
+	filter = FeedFilter{FeedURL: url, ChatID: chatID}
+	switch strings.ToLower(kind) {
+	case "include":
+	case "exclude":
+		filter.Exclude = true
+	default:
+		err = fmt.Errorf("unknown filter kind %s", kind)
+		return
+	}
+
+	pattern = strings.TrimSpace(pattern)
+	if strings.HasPrefix(pattern, feedFilterRegexPrefix) {
+		filter.IsRegex = true
+		pattern = strings.TrimPrefix(pattern, feedFilterRegexPrefix)
+		if _, err = feedFilterRegexps.Get(pattern); err != nil {
+			return
+		}
+	}
+	if pattern == "" {
+		err = fmt.Errorf("filter pattern is empty")
+		return
+	}
+	filter.Pattern = pattern
+	return
+}
+
+// Match function checks news title and description with filter rule
+func (filter FeedFilter) Match(news FeedNews) bool {
+	text := news.Title + "\n" + news.Description
+	if !filter.IsRegex {
+		return strings.Contains(strings.ToLower(text), strings.ToLower(filter.Pattern))
+	}
+
+	re, err := feedFilterRegexps.Get(filter.Pattern)
+	if err != nil {
+		log.Warnf("Invalid regular expression in feed filter %d: %s", filter.ID, err)
+		return false
+	}
+	return re.MatchString(text)
+}
+
+func (filter FeedFilter) String() string {
+	kind := "include"
+	if filter.Exclude {
+		kind = "exclude"
+	}
+	pattern := filter.Pattern
+	if filter.IsRegex {
+		pattern = feedFilterRegexPrefix + pattern
+	}
+	return fmt.Sprintf("%d: %s %s", filter.ID, kind, pattern)
+}
+
+// feedFiltersAllow checks news with filters of chat. If chat has include rules, news must match at least one of them.
+// News matched any exclude rule is suppressed.
+func feedFiltersAllow(filters []FeedFilter, chatID int64, news FeedNews) bool {
+	hasInclude := false
+	included := false
+	for _, filter := range filters {
+		if filter.ChatID != chatID {
+			continue
+		}
+		if filter.Exclude {
+			if filter.Match(news) {
+				return false
+			}
+			continue
+		}
+		hasInclude = true
+		if !included && filter.Match(news) {
+			included = true
+		}
+	}
+	return !hasInclude || included
+}
@@ -0,0 +1,88 @@
+// -*- Go -*-
+/* ------------------------------------------------ */
+/* Golang source                                    */
+/* Author: Alexei Panov <me@elemc.name> 			*/
+/* ------------------------------------------------ */
+
+package main
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// feedRecordHealth stores result of feed update, item count is negative if feed is not modified.
+// It returns true if feed is disabled right now by too many errors in a row.
+func feedRecordHealth(feed *Feeder, err error, itemCount, newItems int) (disabled bool) {
+	feed.LastAttempt = time.Now()
+	if err != nil {
+		feed.LastError = err.Error()
+		if feed.ErrorCount >= options.FeedsDisableAfter && !feed.Disabled {
+			feed.Disabled = true
+			return true
+		}
+		return false
+	}
+
+	feed.LastSuccess = feed.LastAttempt
+	feed.LastError = ""
+	if itemCount >= 0 {
+		feed.ItemCount = itemCount
+	}
+	feed.NewCount += newItems
+	return false
+}
+
+// feedNotifyDisabled notifies users who added disabled feed, chat is notified if user is unknown
+func feedNotifyDisabled(feed Feeder) {
+	subs, err := dbGetFeedSubscriptions(feed.URL)
+	if err != nil {
+		log.Errorf("Unable to get subscriptions for feed %s: %s", feed.URL, err)
+		return
+	}
+	log.Warnf("Feed %s is disabled after %d errors in a row: %s", feed.URL, feed.ErrorCount, feed.LastError)
+
+	notified := make(map[int64]bool)
+	for _, sub := range subs {
+		chatID := sub.ChatID
+		if sub.AddedBy != 0 {
+			chatID = int64(sub.AddedBy)
+		}
+		if notified[chatID] {
+			continue
+		}
+		notified[chatID] = true
+		sendMessage(chatID, chatLocale(chatID).N("feed.disabled", feed.ErrorCount, feed.URL, feed.ErrorCount, feed.LastError, feed.URL), 0)
+	}
+}
+
+// HealthString function returns state of feed for humans
+func (feed *Feeder) HealthString(l Locale) string {
+	switch {
+	case feed.Disabled:
+		return l.T("health.disabled")
+	case feed.ErrorCount > 0:
+		return l.T("health.errors", feed.ErrorCount)
+	case feed.LastAttempt.IsZero():
+		return l.T("health.not_polled")
+	}
+	return l.T("health.ok")
+}
+
+// StatusString function returns health of feed with times of last updates and item counts
+func (feed *Feeder) StatusString(l Locale) string {
+	status := l.T("health.status", feed.HealthString(l), feedTimeString(l, feed.LastAttempt), feedTimeString(l, feed.LastSuccess),
+		feed.ItemCount, feed.NewCount)
+	if feed.LastError != "" {
+		status += l.T("health.error", feed.LastError)
+	}
+	return status
+}
+
+func feedTimeString(l Locale, t time.Time) string {
+	if t.IsZero() {
+		return l.T("health.never")
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
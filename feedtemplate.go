@@ -0,0 +1,198 @@
+// -*- Go -*-
+/* ------------------------------------------------ */
+/* Golang source                                    */
+/* Author: Alexei Panov <me@elemc.name> 			*/
+/* ------------------------------------------------ */
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// images of news are sent as photos, so they are not included in message text
+	feedDefaultTemplate = `{{ bold .FeedTitle }}
+{{ link .Title .Link }}`
+
+	// templates are stored by users, so cache is cleared when it is full
+	feedTemplateCacheSize = 256
+)
+
+// TemplateCache type is a thread-safe cache of parsed message templates
+type TemplateCache struct {
+	cache map[string]*template.Template
+	mutex sync.RWMutex
+}
+
+var (
+	feedTemplates = TemplateCache{cache: make(map[string]*template.Template)}
+
+	feedTemplateTags = regexp.MustCompile(`<[^>]*>`)
+
+	feedTemplateFuncs = template.FuncMap{
+		"truncate": templateTruncate,
+		"escape":   templateEscape,
+		"bold":     templateBold,
+		"italic":   templateItalic,
+		"code":     templateCode,
+		"link":     templateLink,
+		"html":     html.EscapeString,
+		"strip":    templateStripHTML,
+		"join":     strings.Join,
+		"date":     templateDate,
+	}
+
+	feedSampleNews = FeedNews{
+		Title:       "Заголовок новости",
+		Link:        "https://example.com/news/1",
+		Description: "Описание новости",
+		FeedTitle:   "Пример источника",
+		Author:      "Автор",
+		Published:   time.Now(),
+		Categories:  []string{"linux", "fedora"},
+		Enclosures:  []FeedEnclosure{{URL: "https://example.com/news/1.mp3", Type: "audio/mpeg", Length: "1024"}},
+	}
+)
+
+// Get function returns parsed template from cache or parses it
+func (tc *TemplateCache) Get(text string) (tmpl *template.Template, err error) {
+	var ok bool
+	tc.mutex.RLock()
+	tmpl, ok = tc.cache[text]
+	tc.mutex.RUnlock()
+	if ok {
+		return
+	}
+
+	if tmpl, err = feedParseTemplate(text); err != nil {
+		return
+	}
+	tc.mutex.Lock()
+	if len(tc.cache) >= feedTemplateCacheSize {
+		tc.cache = make(map[string]*template.Template)
+	}
+	tc.cache[text] = tmpl
+	tc.mutex.Unlock()
+	return
+}
+
+func feedParseTemplate(text string) (*template.Template, error) {
+	return template.New("message").Funcs(feedTemplateFuncs).Parse(text)
+}
+
+// templateTruncate cuts string to n runes, ellipsis is added to truncated string
+func templateTruncate(n int, s string) string {
+	if n <= 0 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n]) + "…"
+}
+
+// template functions use formatter of messages at the moment of execution, so templates do not depend on parse mode
+func templateEscape(s string) string       { return formatter.Escape(s) }
+func templateBold(s string) string         { return formatter.Bold(s) }
+func templateItalic(s string) string       { return formatter.Italic(s) }
+func templateCode(s string) string         { return formatter.Code(s) }
+func templateLink(text, url string) string { return formatter.Link(text, url) }
+
+// templateStripHTML removes HTML tags and unescapes entities, description of news is stored escaped
+func templateStripHTML(s string) string {
+	s = html.UnescapeString(s)
+	s = feedTemplateTags.ReplaceAllString(s, "")
+	return strings.TrimSpace(html.UnescapeString(s))
+}
+
+func templateDate(layout string, t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(layout)
+}
+
+// feedRenderNews executes template text for news, parsed template is cached
+func feedRenderNews(text string, news FeedNews) (result string, err error) {
+	var tmpl *template.Template
+	if tmpl, err = feedTemplates.Get(text); err != nil {
+		return
+	}
+	return feedExecuteTemplate(tmpl, news)
+}
+
+// feedPreviewNews executes template text for news without caching, it is used for templates which are not stored yet
+func feedPreviewNews(text string, news FeedNews) (result string, err error) {
+	var tmpl *template.Template
+	if tmpl, err = feedParseTemplate(text); err != nil {
+		return
+	}
+	return feedExecuteTemplate(tmpl, news)
+}
+
+func feedExecuteTemplate(tmpl *template.Template, news FeedNews) (result string, err error) {
+	var buf bytes.Buffer
+	if err = tmpl.Execute(&buf, news); err != nil {
+		return
+	}
+	result = buf.String()
+	return
+}
+
+// feedValidateTemplate checks that template is parsed and executed with sample news to non-empty text
+func feedValidateTemplate(text string) (err error) {
+	var result string
+	if result, err = feedPreviewNews(text, feedSampleNews); err != nil {
+		return
+	}
+	if strings.TrimSpace(result) == "" {
+		err = fmt.Errorf("template result is empty")
+	}
+	return
+}
+
+// feedTemplateFor chooses most specific template for feed and chat: feed in chat, chat, feed, global in database,
+// global in configuration and default one
+func feedTemplateFor(templates []FeedTemplate, url string, chatID int64) string {
+	best := -1
+	text := options.FeedsTemplate
+	for _, t := range templates {
+		if (t.FeedURL != "" && t.FeedURL != url) || (t.ChatID != 0 && t.ChatID != chatID) {
+			continue
+		}
+		weight := 0
+		if t.FeedURL != "" {
+			weight++
+		}
+		if t.ChatID != 0 {
+			weight += 2
+		}
+		if weight > best {
+			best = weight
+			text = t.Template
+		}
+	}
+	if text == "" {
+		text = feedDefaultTemplate
+	}
+	return text
+}
+
+func (t FeedTemplate) String() string {
+	scope := "global"
+	switch {
+	case t.FeedURL != "" && t.ChatID != 0:
+		scope = "chat " + t.FeedURL
+	case t.FeedURL != "":
+		scope = "feed " + t.FeedURL
+	case t.ChatID != 0:
+		scope = "chat"
+	}
+	return fmt.Sprintf("%s:\n%s", scope, t.Template)
+}
@@ -0,0 +1,368 @@
+// -*- Go -*-
+/* ------------------------------------------------ */
+/* Golang source                                    */
+/* Author: Alexei Panov <me@elemc.name> 			*/
+/* ------------------------------------------------ */
+
+package main
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Formatter interface is a markup of Telegram messages, all functions escape their arguments
+type Formatter interface {
+	ParseMode() string
+	Escape(s string) string
+	Bold(s string) string
+	Italic(s string) string
+	Code(s string) string
+	Pre(s string) string
+	Link(text, url string) string
+	Mention(text string, userID int) string
+	// Strip converts formatted text to plain text
+	Strip(s string) string
+	// Track returns markup which is open after line, it is closed and opened again if message is split after line
+	Track(open []string, line string) []string
+	// Close returns markup which closes open markup
+	Close(open []string) string
+	// Cut returns number of leading runes of line, no more than n, which can be cut off without breaking markup
+	Cut(line []rune, n int) int
+}
+
+// HTMLFormatter type is a formatter for HTML parse mode
+type HTMLFormatter struct{}
+
+// MarkdownV2Formatter type is a formatter for MarkdownV2 parse mode
+type MarkdownV2Formatter struct{}
+
+// Text type is a builder of formatted message
+type Text struct {
+	f   Formatter
+	buf strings.Builder
+}
+
+var (
+	formatter Formatter = HTMLFormatter{}
+
+	formatHTMLTags = regexp.MustCompile(`<(/?)([a-zA-Z-]+)[^>]*>`)
+
+	markdownV2Escaper     = strings.NewReplacer(markdownV2Pairs(`\_*[]()~` + "`" + `>#+-=|{}.!`)...)
+	markdownV2CodeEscaper = strings.NewReplacer(markdownV2Pairs(`\` + "`")...)
+	markdownV2LinkEscaper = strings.NewReplacer(markdownV2Pairs(`\)`)...)
+)
+
+// newFormatter returns formatter for parse mode, HTML is used by default
+func newFormatter(parseMode string) Formatter {
+	if strings.EqualFold(parseMode, "MarkdownV2") {
+		return MarkdownV2Formatter{}
+	}
+	return HTMLFormatter{}
+}
+
+// ParseMode function returns parse mode of formatter
+func (HTMLFormatter) ParseMode() string { return "HTML" }
+
+// Escape function escapes plain text
+func (HTMLFormatter) Escape(s string) string { return html.EscapeString(s) }
+
+// Bold function returns bold text
+func (f HTMLFormatter) Bold(s string) string { return "<b>" + f.Escape(s) + "</b>" }
+
+// Italic function returns italic text
+func (f HTMLFormatter) Italic(s string) string { return "<i>" + f.Escape(s) + "</i>" }
+
+// Code function returns inline code
+func (f HTMLFormatter) Code(s string) string { return "<code>" + f.Escape(s) + "</code>" }
+
+// Pre function returns block of preformatted text
+func (f HTMLFormatter) Pre(s string) string { return "<pre>" + f.Escape(s) + "</pre>" }
+
+// Link function returns link to URL
+func (f HTMLFormatter) Link(text, url string) string {
+	return fmt.Sprintf(`<a href="%s">%s</a>`, f.Escape(url), f.Escape(text))
+}
+
+// Mention function returns mention of user by ID, it works for users without username
+func (f HTMLFormatter) Mention(text string, userID int) string {
+	return f.Link(text, fmt.Sprintf("tg://user?id=%d", userID))
+}
+
+// Strip function removes tags and unescapes entities
+func (HTMLFormatter) Strip(s string) string {
+	return html.UnescapeString(formatHTMLTags.ReplaceAllString(s, ""))
+}
+
+// Track function returns tags which are open after line
+func (HTMLFormatter) Track(open []string, line string) []string {
+	for _, m := range formatHTMLTags.FindAllStringSubmatch(line, -1) {
+		if m[1] == "" {
+			open = append(open, m[0])
+			continue
+		}
+		for i := len(open) - 1; i >= 0; i-- {
+			if htmlTagName(open[i]) == strings.ToLower(m[2]) {
+				open = append(open[:i], open[i+1:]...)
+				break
+			}
+		}
+	}
+	return open
+}
+
+// Close function returns closing tags for open tags
+func (HTMLFormatter) Close(open []string) (s string) {
+	for i := len(open) - 1; i >= 0; i-- {
+		s += "</" + htmlTagName(open[i]) + ">"
+	}
+	return
+}
+
+// Cut function returns position before n which is not inside of tag or entity
+func (HTMLFormatter) Cut(line []rune, n int) int {
+	var (
+		cut         int
+		tag, entity bool
+	)
+	for i := 0; i <= n && i <= len(line); i++ {
+		if i > 0 && !tag && !entity {
+			cut = i
+		}
+		if i == n || i == len(line) {
+			break
+		}
+		switch c := line[i]; {
+		case tag:
+			tag = c != '>'
+		case entity:
+			entity = c != ';' && !unicode.IsSpace(c)
+		case c == '<':
+			tag = true
+		case c == '&':
+			entity = true
+		}
+	}
+	if cut == 0 {
+		return n
+	}
+	return cut
+}
+
+func htmlTagName(tag string) string {
+	if m := formatHTMLTags.FindStringSubmatch(tag); m != nil {
+		return strings.ToLower(m[2])
+	}
+	return ""
+}
+
+func markdownV2Pairs(chars string) (pairs []string) {
+	for _, c := range chars {
+		pairs = append(pairs, string(c), `\`+string(c))
+	}
+	return
+}
+
+// ParseMode function returns parse mode of formatter
+func (MarkdownV2Formatter) ParseMode() string { return "MarkdownV2" }
+
+// Escape function escapes plain text
+func (MarkdownV2Formatter) Escape(s string) string { return markdownV2Escaper.Replace(s) }
+
+// Bold function returns bold text
+func (f MarkdownV2Formatter) Bold(s string) string { return "*" + f.Escape(s) + "*" }
+
+// Italic function returns italic text
+func (f MarkdownV2Formatter) Italic(s string) string { return "_" + f.Escape(s) + "_" }
+
+// Code function returns inline code
+func (MarkdownV2Formatter) Code(s string) string { return "`" + markdownV2CodeEscaper.Replace(s) + "`" }
+
+// Pre function returns block of preformatted text
+func (MarkdownV2Formatter) Pre(s string) string {
+	return codeFence + "\n" + markdownV2CodeEscaper.Replace(s) + "\n" + codeFence
+}
+
+// Link function returns link to URL
+func (f MarkdownV2Formatter) Link(text, url string) string {
+	return fmt.Sprintf("[%s](%s)", f.Escape(text), markdownV2LinkEscaper.Replace(url))
+}
+
+// Mention function returns mention of user by ID, it works for users without username
+func (f MarkdownV2Formatter) Mention(text string, userID int) string {
+	return f.Link(text, fmt.Sprintf("tg://user?id=%d", userID))
+}
+
+// Strip function removes markup and escaping, links are left as text
+func (MarkdownV2Formatter) Strip(s string) string {
+	var (
+		buf     strings.Builder
+		escaped bool
+	)
+	for _, c := range s {
+		switch {
+		case escaped:
+			buf.WriteRune(c)
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case strings.ContainsRune("*_~`|", c):
+		default:
+			buf.WriteRune(c)
+		}
+	}
+	return buf.String()
+}
+
+// Track function returns code block which is open after line
+func (MarkdownV2Formatter) Track(open []string, line string) []string {
+	if strings.Count(line, codeFence)%2 == 0 {
+		return open
+	}
+	if len(open) > 0 {
+		return nil
+	}
+	return []string{codeFence + "\n"}
+}
+
+// Close function returns end of open code block
+func (MarkdownV2Formatter) Close(open []string) string {
+	if len(open) > 0 {
+		return "\n" + codeFence
+	}
+	return ""
+}
+
+// Cut function returns position before n outside of inline markup and links, if there is no such position
+// the last one which is not after escaping backslash is returned
+func (MarkdownV2Formatter) Cut(line []rune, n int) int {
+	var (
+		cut, loose    int
+		escaped, code bool
+		link          int // 1 in text of link, 2 in URL of link
+		open          = make(map[string]bool)
+	)
+	for i := 0; i <= n && i <= len(line); i++ {
+		if i > 0 && !escaped {
+			loose = i
+			if !code && link == 0 && len(open) == 0 {
+				cut = i
+			}
+		}
+		if i == n || i == len(line) {
+			break
+		}
+		c := line[i]
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '`':
+			code = !code
+		case code:
+		case link == 2:
+			if c == ')' {
+				link = 0
+			}
+		case c == '[':
+			link = 1
+		case c == ']' && link == 1:
+			if i+1 < len(line) && line[i+1] == '(' {
+				link = 2
+				i++
+			} else {
+				link = 0
+			}
+		case strings.ContainsRune("*_~|", c):
+			marker := string(c)
+			if (c == '_' || c == '|') && i+1 < len(line) && line[i+1] == c {
+				marker += string(c)
+				i++
+			}
+			if open[marker] {
+				delete(open, marker)
+			} else {
+				open[marker] = true
+			}
+		}
+	}
+	switch {
+	case cut > 0:
+		return cut
+	case loose > 0:
+		return loose
+	}
+	return n
+}
+
+// newText returns builder of message with current formatter
+func newText() *Text {
+	return &Text{f: formatter}
+}
+
+// Plain function appends escaped text
+func (t *Text) Plain(s string) *Text {
+	t.buf.WriteString(t.f.Escape(s))
+	return t
+}
+
+// Plainf function appends escaped formatted text
+func (t *Text) Plainf(format string, args ...interface{}) *Text {
+	return t.Plain(fmt.Sprintf(format, args...))
+}
+
+// Bold function appends bold text
+func (t *Text) Bold(s string) *Text {
+	t.buf.WriteString(t.f.Bold(s))
+	return t
+}
+
+// Italic function appends italic text
+func (t *Text) Italic(s string) *Text {
+	t.buf.WriteString(t.f.Italic(s))
+	return t
+}
+
+// Code function appends inline code
+func (t *Text) Code(s string) *Text {
+	t.buf.WriteString(t.f.Code(s))
+	return t
+}
+
+// Pre function appends block of preformatted text
+func (t *Text) Pre(s string) *Text {
+	t.buf.WriteString(t.f.Pre(s))
+	return t
+}
+
+// Link function appends link to URL
+func (t *Text) Link(text, url string) *Text {
+	t.buf.WriteString(t.f.Link(text, url))
+	return t
+}
+
+// Mention function appends mention of user
+func (t *Text) Mention(text string, userID int) *Text {
+	t.buf.WriteString(t.f.Mention(text, userID))
+	return t
+}
+
+// Raw function appends text which is formatted already
+func (t *Text) Raw(s string) *Text {
+	t.buf.WriteString(s)
+	return t
+}
+
+// Line function appends new line
+func (t *Text) Line() *Text {
+	t.buf.WriteString("\n")
+	return t
+}
+
+func (t *Text) String() string {
+	return t.buf.String()
+}
@@ -54,6 +54,13 @@ func httpInit() {
 	router.GET("/chat/:chat/:year", httpYearHandler)
 	router.GET("/chat/:chat/:year/:month", httpMonthHandler)
 	router.GET("/chat/:chat/:year/:month/:day", httpDayHandler)
+	router.GET("/feeds", httpFeedsHandler)
+	router.GET("/feeds.opml", httpFeedsOPMLHandler)
+	router.GET("/pulse.atom", httpPulseFeedHandler)
+	router.GET("/pulse.rss", httpPulseFeedHandler)
+	router.GET("/pulse.json", httpPulseFeedHandler)
+	router.POST("/api/pulse", httpPushHandler)
+	router.GET("/metrics", httpMetricsHandler)
 
 }
 
@@ -103,6 +110,18 @@ func httpFinishOK(ctx *fasthttp.RequestCtx, data string) {
 	log.Debugf("Status OK: %s", data)
 }
 
+// httpMetricsHandler returns metrics of outgoing queue, it is authorized with API tokens as push API
+func httpMetricsHandler(ctx *fasthttp.RequestCtx) {
+	httpInitRequest(ctx)
+	if !pushAuthorized(ctx) {
+		log.Warnf("Unauthorized metrics request from %s", ctx.RemoteIP().String())
+		httpFinish(ctx, fasthttp.StatusUnauthorized, "unauthorized")
+		return
+	}
+	ctx.SetContentType("text/plain; version=0.0.4")
+	httpFinish(ctx, fasthttp.StatusOK, outgoing.Metrics())
+}
+
 func writeStringList(ctx *fasthttp.RequestCtx, name string, list []string) {
 	if len(list) > 0 {
 		ctx.WriteString(fmt.Sprintf("<h2>%s:</h2>\n<ul>", name))
@@ -128,6 +147,13 @@ func writeTable(ctx *fasthttp.RequestCtx, path string, data []string, columns in
 	ctx.WriteString("\t</tr>\n</table>\n")
 }
 
+func httpTimeString(l Locale, t time.Time) string {
+	if t.IsZero() {
+		return l.T("web.never")
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
 func httpRootHandler(ctx *fasthttp.RequestCtx) {
 	httpInitRequest(ctx)
 	ctx.SetContentType("text/html")
@@ -160,10 +186,12 @@ func httpRootHandler(ctx *fasthttp.RequestCtx) {
 		}
 	}
 
+	l := httpLocale(ctx)
 	ctx.WriteString(htmlHeader)
-	writeStringList(ctx, "Groups", groups)
-	writeStringList(ctx, "Users", privateChats)
-	writeStringList(ctx, "Channels", channels)
+	writeStringList(ctx, l.T("web.groups"), groups)
+	writeStringList(ctx, l.T("web.users"), privateChats)
+	writeStringList(ctx, l.T("web.channels"), channels)
+	ctx.WriteString(fmt.Sprintf(`<h2><a href="/feeds">%s</a></h2>`, l.T("web.feeds")))
 	ctx.WriteString(htmlFooter)
 
 	ctx.SetStatusCode(fasthttp.StatusOK)
@@ -179,7 +207,7 @@ func httpChatHandler(ctx *fasthttp.RequestCtx) {
 
 	strChatID := ctx.UserValue("chat").(string)
 	if chatID, err = strconv.ParseInt(strChatID, 10, 64); err != nil {
-		httpFinishBadParam(ctx, fmt.Sprintf("Chat ID is not integer"))
+		httpFinishBadParam(ctx, httpLocale(ctx).T("web.bad_chat_id"))
 		log.Error(err)
 		return
 	}
@@ -213,13 +241,13 @@ func httpYearHandler(ctx *fasthttp.RequestCtx) {
 
 	strChatID := ctx.UserValue("chat").(string)
 	if chatID, err = strconv.ParseInt(strChatID, 10, 64); err != nil {
-		httpFinishBadParam(ctx, fmt.Sprintf("Chat ID is not integer"))
+		httpFinishBadParam(ctx, httpLocale(ctx).T("web.bad_chat_id"))
 		log.Error(err)
 		return
 	}
 	strYear := ctx.UserValue("year").(string)
 	if year, err = strconv.Atoi(strYear); err != nil {
-		httpFinishBadParam(ctx, fmt.Sprintf("Year is not integer"))
+		httpFinishBadParam(ctx, httpLocale(ctx).T("web.bad_year"))
 		log.Error(err)
 		return
 	}
@@ -254,19 +282,19 @@ func httpMonthHandler(ctx *fasthttp.RequestCtx) {
 
 	strChatID := ctx.UserValue("chat").(string)
 	if chatID, err = strconv.ParseInt(strChatID, 10, 64); err != nil {
-		httpFinishBadParam(ctx, fmt.Sprintf("Chat ID is not integer"))
+		httpFinishBadParam(ctx, httpLocale(ctx).T("web.bad_chat_id"))
 		log.Error(err)
 		return
 	}
 	strYear := ctx.UserValue("year").(string)
 	if year, err = strconv.Atoi(strYear); err != nil {
-		httpFinishBadParam(ctx, fmt.Sprintf("Year is not integer"))
+		httpFinishBadParam(ctx, httpLocale(ctx).T("web.bad_year"))
 		log.Error(err)
 		return
 	}
 	strMonth := ctx.UserValue("month").(string)
 	if month, err = strconv.Atoi(strMonth); err != nil {
-		httpFinishBadParam(ctx, fmt.Sprintf("Month is not integer"))
+		httpFinishBadParam(ctx, httpLocale(ctx).T("web.bad_month"))
 		log.Error(err)
 		return
 	}
@@ -302,25 +330,25 @@ func httpDayHandler(ctx *fasthttp.RequestCtx) {
 
 	strChatID := ctx.UserValue("chat").(string)
 	if chatID, err = strconv.ParseInt(strChatID, 10, 64); err != nil {
-		httpFinishBadParam(ctx, fmt.Sprintf("Chat ID is not integer"))
+		httpFinishBadParam(ctx, httpLocale(ctx).T("web.bad_chat_id"))
 		log.Error(err)
 		return
 	}
 	strYear := ctx.UserValue("year").(string)
 	if year, err = strconv.Atoi(strYear); err != nil {
-		httpFinishBadParam(ctx, fmt.Sprintf("Year is not integer"))
+		httpFinishBadParam(ctx, httpLocale(ctx).T("web.bad_year"))
 		log.Error(err)
 		return
 	}
 	strMonth := ctx.UserValue("month").(string)
 	if month, err = strconv.Atoi(strMonth); err != nil {
-		httpFinishBadParam(ctx, fmt.Sprintf("Month is not integer"))
+		httpFinishBadParam(ctx, httpLocale(ctx).T("web.bad_month"))
 		log.Error(err)
 		return
 	}
 	strDay := ctx.UserValue("day").(string)
 	if day, err = strconv.Atoi(strDay); err != nil {
-		httpFinishBadParam(ctx, fmt.Sprintf("Day is not integer"))
+		httpFinishBadParam(ctx, httpLocale(ctx).T("web.bad_day"))
 		log.Error(err)
 		return
 	}
@@ -338,18 +366,19 @@ func httpDayHandler(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
-	ctx.WriteString("<h2>Messages:</h2>")
+	l := httpLocale(ctx)
+	ctx.WriteString(fmt.Sprintf("<h2>%s</h2>", l.T("web.messages")))
 
-	ctx.WriteString(`<table width="80%">
+	ctx.WriteString(fmt.Sprintf(`<table width="80%%">
 <thead>
 	<tr>
-		<th align="center" width="5%"></th>
-		<th align="center width="10%">Time</th>
-		<th align="center" width="10%">User</th>
-		<th align="center" width="75%">Message</th>
+		<th align="center" width="5%%"></th>
+		<th align="center width="10%%">%s</th>
+		<th align="center" width="10%%">%s</th>
+		<th align="center" width="75%%">%s</th>
 	</tr>
 </thead>
-<tbody>`)
+<tbody>`, l.T("web.time"), l.T("web.user"), l.T("web.message")))
 
 	var data []string
 	for _, msg := range msgs {
@@ -368,10 +397,10 @@ func httpDayHandler(ctx *fasthttp.RequestCtx) {
 
 		photo, _ := getUserPhotoFilename(msg.UserFrom)
 		if msg.Audio != nil {
-			messageText += fmt.Sprintf(`<p><a href="/static/%s">Audio in message</a></p>`, getShortFileName(msg.Audio.FileID))
+			messageText += fmt.Sprintf(`<p><a href="/static/%s">%s</a></p>`, getShortFileName(msg.Audio.FileID), l.T("web.audio"))
 		}
 		if msg.Document != nil {
-			messageText += fmt.Sprintf(`<p><a href="/static/%s">Document in message</a></p>`, getShortFileName(msg.Document.FileID))
+			messageText += fmt.Sprintf(`<p><a href="/static/%s">%s</a></p>`, getShortFileName(msg.Document.FileID), l.T("web.document"))
 		}
 		if msg.Photo != nil {
 			f := (*msg.Photo)[len(*msg.Photo)-1]
@@ -383,15 +412,15 @@ func httpDayHandler(ctx *fasthttp.RequestCtx) {
 			messageText += fmt.Sprintf(`<p><img src="/static/%s"></img></p>`, getShortFileName(msg.Sticker.FileID))
 		}
 		if msg.Video != nil {
-			messageText += fmt.Sprintf(`<p><a href="/static/%s">Video in message</a></p>`, getShortFileName(msg.Video.FileID))
+			messageText += fmt.Sprintf(`<p><a href="/static/%s">%s</a></p>`, getShortFileName(msg.Video.FileID), l.T("web.video"))
 		}
 		if msg.Voice != nil {
-			messageText += fmt.Sprintf(`<p><a href="/static/%s">Voice in message</a></p>`, getShortFileName(msg.Voice.FileID))
+			messageText += fmt.Sprintf(`<p><a href="/static/%s">%s</a></p>`, getShortFileName(msg.Voice.FileID), l.T("web.voice"))
 		}
 
 		photoTD := fmt.Sprintf(`<td align="center"><a href="/static/%s"><img src="/static/%s" height="30px" width="30px"></img></td>`, photo, photo)
 		if photo == "" {
-			photoTD = `<td align="center">no image</td>`
+			photoTD = fmt.Sprintf(`<td align="center">%s</td>`, l.T("web.no_image"))
 		}
 
 		data = append(data, (fmt.Sprintf(`	<tr style="background-color: #F5F5F5;">
@@ -0,0 +1,136 @@
+// -*- Go -*-
+/* ------------------------------------------------ */
+/* Golang source                                    */
+/* Author: Alexei Panov <me@elemc.name> 			*/
+/* ------------------------------------------------ */
+
+package main
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+func httpFeedsHandler(ctx *fasthttp.RequestCtx) {
+	httpInitRequest(ctx)
+	var (
+		err    error
+		feeds  []Feeder
+		counts map[string]int
+	)
+
+	if feeds, err = dbGetAllFeeds(); err != nil {
+		httpFinishError(ctx, err)
+		return
+	}
+	if counts, err = dbFeedNewsCounts(time.Now().AddDate(0, 0, -7)); err != nil {
+		httpFinishError(ctx, err)
+		return
+	}
+
+	l := httpLocale(ctx)
+	ctx.SetContentType("text/html")
+	ctx.WriteString(htmlHeader)
+	ctx.WriteString(l.T("web.feeds_title"))
+
+	categories, groups := feedsByCategory(feeds)
+	for _, category := range categories {
+		total := 0
+		for _, feed := range groups[category] {
+			total += counts[feed.URL]
+		}
+		title := category
+		if title == "" {
+			title = l.T("web.uncategorized")
+		}
+		ctx.WriteString(fmt.Sprintf("<h3>%s</h3>\n", l.N("web.week_items", total, html.EscapeString(title), total)))
+		writeFeedsTable(ctx, l, groups[category], counts)
+	}
+
+	ctx.WriteString(htmlFooter)
+	ctx.SetStatusCode(fasthttp.StatusOK)
+}
+
+func writeFeedsTable(ctx *fasthttp.RequestCtx, l Locale, feeds []Feeder, counts map[string]int) {
+	var data []string
+	ctx.WriteString(fmt.Sprintf(`<table width="80%%">
+<thead>
+	<tr>
+		<th align="center" width="25%%">%s</th>
+		<th align="center" width="10%%">%s</th>
+		<th align="center" width="10%%">%s</th>
+		<th align="center" width="10%%">%s</th>
+		<th align="center" width="5%%">%s</th>
+		<th align="center" width="5%%">%s</th>
+		<th align="center" width="5%%">%s</th>
+		<th align="center" width="30%%">%s</th>
+	</tr>
+</thead>
+<tbody>`, l.T("web.feed"), l.T("web.status"), l.T("web.last_attempt"), l.T("web.last_success"),
+		l.T("web.items"), l.T("web.new"), l.T("web.week"), l.T("web.last_error")))
+
+	for _, feed := range feeds {
+		status := l.T("web.status_ok")
+		switch {
+		case feed.Disabled:
+			status = l.T("web.status_disabled")
+		case feed.ErrorCount > 0:
+			status = l.N("web.status_errors", feed.ErrorCount, feed.ErrorCount)
+		case feed.LastAttempt.IsZero():
+			status = l.T("web.status_not_polled")
+		}
+
+		data = append(data, fmt.Sprintf(`	<tr style="background-color: #F5F5F5;">
+		<td><a href="%s">%s</a></td>
+		<td align="center">%s</td>
+		<td align="center">%s</td>
+		<td align="center">%s</td>
+		<td align="center">%d</td>
+		<td align="center">%d</td>
+		<td align="center">%d</td>
+		<td>%s</td>
+	</tr>`, html.EscapeString(feed.URL), html.EscapeString(feed.Name), status, httpTimeString(l, feed.LastAttempt), httpTimeString(l, feed.LastSuccess),
+			feed.ItemCount, feed.NewCount, counts[feed.URL], html.EscapeString(feed.LastError)))
+	}
+	ctx.WriteString(strings.Join(data, "\n"))
+	ctx.WriteString("</tbody>\n</table>\n")
+}
+
+// httpFeedsOPMLHandler exports feeds in OPML, feeds of chat are exported with `chat` argument
+func httpFeedsOPMLHandler(ctx *fasthttp.RequestCtx) {
+	httpInitRequest(ctx)
+	var (
+		err    error
+		feeds  []Feeder
+		data   []byte
+		chatID int64
+	)
+
+	if args := ctx.QueryArgs(); args.Has("chat") {
+		if chatID, err = strconv.ParseInt(string(args.Peek("chat")), 10, 64); err != nil {
+			httpFinishBadParam(ctx, httpLocale(ctx).T("web.bad_chat_id"))
+			return
+		}
+		feeds, err = opmlChatFeeds(chatID)
+	} else {
+		feeds, err = dbGetAllFeeds()
+	}
+	if err != nil {
+		httpFinishError(ctx, err)
+		return
+	}
+
+	if data, err = opmlExport(feeds, "Pulse"); err != nil {
+		httpFinishError(ctx, err)
+		return
+	}
+	ctx.SetContentType("text/x-opml; charset=utf-8")
+	ctx.Response.Header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", opmlFileName))
+	ctx.Write(data)
+	ctx.SetStatusCode(fasthttp.StatusOK)
+}
@@ -0,0 +1,210 @@
+// -*- Go -*-
+/* ------------------------------------------------ */
+/* Golang source                                    */
+/* Author: Alexei Panov <me@elemc.name> 			*/
+/* ------------------------------------------------ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+// Locale type is a code of language of messages, for example ru or en
+type Locale string
+
+// CatalogMessage type is a message of catalog, it is a format string or object with plural forms (one, few, many, other)
+type CatalogMessage struct {
+	Text  string
+	Forms map[string]string
+}
+
+// Catalog type is a set of messages of locale by keys
+type Catalog map[string]CatalogMessage
+
+var (
+	catalogs = make(map[Locale]Catalog)
+)
+
+// UnmarshalJSON function reads message from string or object with plural forms
+func (m *CatalogMessage) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &m.Text); err == nil {
+		return nil
+	}
+	return json.Unmarshal(data, &m.Forms)
+}
+
+// LoadLocales function loads catalogs from JSON files in directory, name of file is a code of locale
+func LoadLocales(path string) (err error) {
+	var files []string
+	if files, err = filepath.Glob(filepath.Join(path, "*.json")); err != nil {
+		return
+	}
+	for _, file := range files {
+		var (
+			data    []byte
+			catalog Catalog
+		)
+		if data, err = ioutil.ReadFile(file); err != nil {
+			return
+		}
+		if err = json.Unmarshal(data, &catalog); err != nil {
+			return fmt.Errorf("unable to parse catalog %s: %s", file, err)
+		}
+		locale := Locale(strings.TrimSuffix(filepath.Base(file), ".json"))
+		catalogs[locale] = catalog
+		log.Debugf("Catalog %s with %d messages loaded", locale, len(catalog))
+	}
+	if _, ok := catalogs[Locale(options.Language)]; !ok {
+		return fmt.Errorf("catalog of default language %s is not found in %s", options.Language, path)
+	}
+	return
+}
+
+// localeFor returns supported locale for language code like en-US, empty locale is returned if it is not supported
+func localeFor(code string) Locale {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if i := strings.IndexAny(code, "-_"); i >= 0 {
+		code = code[:i]
+	}
+	if _, ok := catalogs[Locale(code)]; ok {
+		return Locale(code)
+	}
+	return ""
+}
+
+// availableLocales returns sorted codes of loaded catalogs
+func availableLocales() (locales []string) {
+	for locale := range catalogs {
+		locales = append(locales, string(locale))
+	}
+	sort.Strings(locales)
+	return
+}
+
+// chatLocale returns language of chat, default language is used if it is not set
+func chatLocale(chatID int64) Locale {
+	if settings, err := chatSettings.Get(chatID); err != nil {
+		log.Errorf("Unable to get settings for chat %d: %s", chatID, err)
+	} else if locale := localeFor(settings.Language); locale != "" {
+		return locale
+	}
+	return Locale(options.Language)
+}
+
+// userLocale returns language of chat, language of user is used if language of chat is not set
+func userLocale(chat *tgbotapi.Chat, user *tgbotapi.User) Locale {
+	if chat != nil {
+		if settings, err := chatSettings.Get(chat.ID); err != nil {
+			log.Errorf("Unable to get settings for chat %d: %s", chat.ID, err)
+		} else if locale := localeFor(settings.Language); locale != "" {
+			return locale
+		}
+	}
+	if user != nil {
+		if locale := localeFor(user.LanguageCode); locale != "" {
+			return locale
+		}
+	}
+	return Locale(options.Language)
+}
+
+// msgLocale returns language for reply to message
+func msgLocale(msg *tgbotapi.Message) Locale {
+	return userLocale(msg.Chat, msg.From)
+}
+
+// httpLocale returns language of web page from `lang` argument or Accept-Language header
+func httpLocale(ctx *fasthttp.RequestCtx) Locale {
+	if locale := localeFor(string(ctx.QueryArgs().Peek("lang"))); locale != "" {
+		return locale
+	}
+	for _, lang := range strings.Split(string(ctx.Request.Header.Peek("Accept-Language")), ",") {
+		if locale := localeFor(strings.Split(lang, ";")[0]); locale != "" {
+			return locale
+		}
+	}
+	return Locale(options.Language)
+}
+
+// tr returns translated message for reply to msg
+func tr(msg *tgbotapi.Message, key string, args ...interface{}) string {
+	return msgLocale(msg).T(key, args...)
+}
+
+func (l Locale) message(key string) (CatalogMessage, bool) {
+	if m, ok := catalogs[l][key]; ok {
+		return m, true
+	}
+	m, ok := catalogs[Locale(options.Language)][key]
+	if !ok {
+		log.Warnf("Message %s is not found in catalogs", key)
+	}
+	return m, ok
+}
+
+// T function returns translated message formatted with arguments, message of default language is used
+// if translation is not found, and key is used if message is not found at all
+func (l Locale) T(key string, args ...interface{}) string {
+	m, ok := l.message(key)
+	if !ok {
+		return key
+	}
+	text := m.Text
+	if text == "" {
+		text = m.Forms["other"]
+	}
+	return localeFormat(text, args)
+}
+
+// N function returns translated message in plural form for n
+func (l Locale) N(key string, n int, args ...interface{}) string {
+	m, ok := l.message(key)
+	if !ok {
+		return key
+	}
+	text, ok := m.Forms[l.pluralForm(n)]
+	if !ok {
+		if text = m.Forms["other"]; text == "" {
+			text = m.Text
+		}
+	}
+	return localeFormat(text, args)
+}
+
+// pluralForm returns plural form of number by rules of language
+func (l Locale) pluralForm(n int) string {
+	if n < 0 {
+		n = -n
+	}
+	switch l {
+	case "ru", "uk", "be":
+		switch {
+		case n%10 == 1 && n%100 != 11:
+			return "one"
+		case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+			return "few"
+		}
+		return "many"
+	}
+	if n == 1 {
+		return "one"
+	}
+	return "other"
+}
+
+func localeFormat(text string, args []interface{}) string {
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
@@ -36,12 +36,21 @@ func main() {
 		log.SetLevel(level)
 	}
 
+	if err = LoadLocales(options.LocalesPath); err != nil {
+		log.Fatalf("Unable to load locales: %s", err)
+	}
+
 	log.Warnf("Application started...")
 
 	if err = InitDatabase(); err != nil {
 		log.Fatalf("Unable to connect to database: %s", err)
 	}
+	go outgoing.Run()
 	go cacheUpdate()
+	go blocklistUpdate()
+	go feedNewsRetention()
+	go cooldownSweep()
+	go slowModeSweep()
 
 	wg.Add(1)
 	go func() {
@@ -58,6 +67,8 @@ func main() {
 	}()
 	wg.Add(1)
 	go updateFeeds()
+	wg.Add(1)
+	go feedDigests()
 
 	wg.Wait()
 }
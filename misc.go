@@ -6,6 +6,20 @@
 
 package main
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	codeFence          = "```"
+	splitMarkupReserve = 64
+)
+
 func appendStringToSliceIfNotFound(slice []string, str string) []string {
 	for _, l := range slice {
 		if l == str {
@@ -16,3 +30,103 @@ func appendStringToSliceIfNotFound(slice []string, str string) []string {
 	slice = append(slice, str)
 	return slice
 }
+
+// parseHoursRange parses hours range in format `23-7`
+func parseHoursRange(s string) (start, end int, err error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		err = fmt.Errorf("invalid hours range %s", s)
+		return
+	}
+	if start, err = strconv.Atoi(strings.TrimSpace(parts[0])); err != nil {
+		return
+	}
+	if end, err = strconv.Atoi(strings.TrimSpace(parts[1])); err != nil {
+		return
+	}
+	if start < 0 || start > 23 || end < 0 || end > 23 {
+		err = fmt.Errorf("hours out of range in %s", s)
+	}
+	return
+}
+
+// durationString formats wait duration rounded up to seconds
+func durationString(d time.Duration) string {
+	if d <= 0 {
+		return "0s"
+	}
+	return (d + time.Second - 1).Truncate(time.Second).String()
+}
+
+// splitArguments splits n leading words of arguments, rest of arguments is returned as is with line breaks
+func splitArguments(args string, n int) (words []string, rest string) {
+	rest = strings.TrimSpace(args)
+	for i := 0; i < n && rest != ""; i++ {
+		end := strings.IndexFunc(rest, unicode.IsSpace)
+		if end < 0 {
+			end = len(rest)
+		}
+		words = append(words, rest[:end])
+		rest = strings.TrimSpace(rest[end:])
+	}
+	return
+}
+
+// splitMessage splits formatted text to parts of no more than limit runes on line boundaries, too long lines are split
+// where formatter allows it. Markup which is open at the end of part is closed and opened again in the next part.
+func splitMessage(text string, limit int, f Formatter) (parts []string) {
+	if utf8.RuneCountInString(text) <= limit {
+		return []string{text}
+	}
+	// reserve room for markup closed at the end of part and opened again at the beginning of the next one
+	limit -= splitMarkupReserve
+
+	var (
+		lines []string
+		size  int
+		open  []string
+	)
+	prefix := ""
+	flush := func() {
+		parts = append(parts, prefix+strings.Join(lines, "\n")+f.Close(open))
+		prefix = strings.Join(open, "")
+		lines, size = nil, 0
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		for _, chunk := range splitRunes(line, limit, f) {
+			n := utf8.RuneCountInString(chunk)
+			if len(lines) > 0 && size+1+n > limit {
+				flush()
+			}
+			if len(lines) > 0 {
+				size++
+			}
+			lines = append(lines, chunk)
+			size += n
+			open = f.Track(open, chunk)
+		}
+	}
+	if len(lines) > 0 {
+		flush()
+	}
+	return
+}
+
+// splitRunes splits string to chunks of no more than n runes, chunks are not cut inside of tags, entities and escapes
+func splitRunes(s string, n int, f Formatter) (chunks []string) {
+	runes := []rune(s)
+	for len(runes) > n {
+		cut := f.Cut(runes, n)
+		chunks = append(chunks, string(runes[:cut]))
+		runes = runes[cut:]
+	}
+	return append(chunks, string(runes))
+}
+
+func onOffString(l Locale, on bool) string {
+	if on {
+		return l.T("common.on")
+	}
+	return l.T("common.off")
+}
@@ -0,0 +1,138 @@
+// -*- Go -*-
+/* ------------------------------------------------ */
+/* Golang source                                    */
+/* Author: Alexei Panov <me@elemc.name> 			*/
+/* ------------------------------------------------ */
+
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+var (
+	testHTMLTag    = regexp.MustCompile(`<[^<>]*>`)
+	testHTMLEntity = regexp.MustCompile(`&[a-zA-Z0-9#]+;`)
+)
+
+func TestHTMLFormatterCut(t *testing.T) {
+	tests := []struct {
+		line string
+		n    int
+		want int
+	}{
+		{"plain text", 5, 5},
+		{`ab<a href="x">c</a>`, 5, 2},
+		{"ab&amp;cd", 4, 2},
+		{"ab&amp;cd", 7, 7},
+		{"<b>bold</b>", 9, 7},
+		{`<a href="very long url">`, 5, 5},
+	}
+	for _, test := range tests {
+		if got := (HTMLFormatter{}).Cut([]rune(test.line), test.n); got != test.want {
+			t.Errorf("Cut(%q, %d) = %d, want %d", test.line, test.n, got, test.want)
+		}
+	}
+}
+
+func TestMarkdownV2FormatterCut(t *testing.T) {
+	tests := []struct {
+		line string
+		n    int
+		want int
+	}{
+		{"plain text", 5, 5},
+		{`ab\.cd`, 3, 2},
+		{`ab\\cd`, 4, 4},
+		{"ab *bold* cd", 6, 3},
+		{"ab [link](https://example.com) cd", 20, 3},
+		{"ab `code` cd", 6, 3},
+		{"*very long bold text*", 10, 10},
+		{`*a\.b\.c*`, 3, 2},
+	}
+	for _, test := range tests {
+		if got := (MarkdownV2Formatter{}).Cut([]rune(test.line), test.n); got != test.want {
+			t.Errorf("Cut(%q, %d) = %d, want %d", test.line, test.n, got, test.want)
+		}
+	}
+}
+
+func TestSplitMessageHTML(t *testing.T) {
+	f := HTMLFormatter{}
+	line := strings.Repeat(`<a href="https://example.com/news?id=1&amp;page=2">Tom &amp; Jerry</a> <b>bold</b> `, 20)
+	text := "title\n" + line + "\n" + line
+	limit := 200
+
+	parts := splitMessage(text, limit, f)
+	if len(parts) < 2 {
+		t.Fatalf("text is not split: %d parts", len(parts))
+	}
+	var stripped []string
+	for i, part := range parts {
+		if n := utf8.RuneCountInString(part); n > limit {
+			t.Errorf("part %d has %d runes, limit is %d", i, n, limit)
+		}
+		rest := testHTMLEntity.ReplaceAllString(testHTMLTag.ReplaceAllString(part, ""), "")
+		if strings.ContainsAny(rest, "<>&") {
+			t.Errorf("part %d has broken tag or entity: %q", i, part)
+		}
+		if open := f.Track(nil, part); len(open) > 0 {
+			t.Errorf("part %d has unclosed tags %v: %q", i, open, part)
+		}
+		stripped = append(stripped, f.Strip(part))
+	}
+	if got, want := strings.Replace(strings.Join(stripped, ""), "\n", "", -1), strings.Replace(f.Strip(text), "\n", "", -1); got != want {
+		t.Errorf("text is changed by split:\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestSplitMessageMarkdownV2(t *testing.T) {
+	f := MarkdownV2Formatter{}
+	line := strings.Repeat(`*Tom \& Jerry\.* [link](https://example.com/a\)b) \\ _it\_alic_ `, 20)
+	text := "title\n" + line
+	limit := 200
+
+	parts := splitMessage(text, limit, f)
+	if len(parts) < 2 {
+		t.Fatalf("text is not split: %d parts", len(parts))
+	}
+	var stripped []string
+	for i, part := range parts {
+		if n := utf8.RuneCountInString(part); n > limit {
+			t.Errorf("part %d has %d runes, limit is %d", i, n, limit)
+		}
+		trailing := len(part) - len(strings.TrimRight(part, `\`))
+		if trailing%2 == 1 {
+			t.Errorf("part %d ends with lone backslash: %q", i, part)
+		}
+		if !testMarkdownV2Balanced(part) {
+			t.Errorf("part %d has unclosed markup: %q", i, part)
+		}
+		stripped = append(stripped, f.Strip(part))
+	}
+	if got, want := strings.Replace(strings.Join(stripped, ""), "\n", "", -1), strings.Replace(f.Strip(text), "\n", "", -1); got != want {
+		t.Errorf("text is changed by split:\n%q\nwant\n%q", got, want)
+	}
+}
+
+// testMarkdownV2Balanced checks that all unescaped markers of bold, italic and links are closed
+func testMarkdownV2Balanced(s string) bool {
+	var (
+		escaped bool
+		counts  = make(map[rune]int)
+	)
+	for _, c := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case strings.ContainsRune("*_[]()", c):
+			counts[c]++
+		}
+	}
+	return !escaped && counts['*']%2 == 0 && counts['_']%2 == 0 && counts['['] == counts[']'] && counts['('] == counts[')']
+}
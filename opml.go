@@ -0,0 +1,200 @@
+// -*- Go -*-
+/* ------------------------------------------------ */
+/* Golang source                                    */
+/* Author: Alexei Panov <me@elemc.name> 			*/
+/* ------------------------------------------------ */
+
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+const (
+	opmlFileName = "feeds.opml"
+)
+
+// OPML is a type for OPML document with list of feeds
+type OPML struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    OPMLHead `xml:"head"`
+	Body    OPMLBody `xml:"body"`
+}
+
+// OPMLHead is a type for head of OPML document
+type OPMLHead struct {
+	Title       string `xml:"title"`
+	DateCreated string `xml:"dateCreated,omitempty"`
+}
+
+// OPMLBody is a type for body of OPML document
+type OPMLBody struct {
+	Outlines []OPMLOutline `xml:"outline"`
+}
+
+// OPMLOutline is a type for feed or group of feeds in OPML document
+type OPMLOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr,omitempty"`
+	Type     string        `xml:"type,attr,omitempty"`
+	XMLURL   string        `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL  string        `xml:"htmlUrl,attr,omitempty"`
+	Category string        `xml:"category,attr,omitempty"`
+	Outlines []OPMLOutline `xml:"outline"`
+}
+
+// opmlExport builds OPML document with feeds
+func opmlExport(feeds []Feeder, title string) (data []byte, err error) {
+	doc := OPML{
+		Version: "2.0",
+		Head:    OPMLHead{Title: title, DateCreated: time.Now().Format(time.RFC1123Z)},
+	}
+	for _, feed := range feeds {
+		name := feed.Name
+		if name == "" {
+			name = feed.URL
+		}
+		doc.Body.Outlines = append(doc.Body.Outlines, OPMLOutline{Text: name, Title: name, Type: "rss", XMLURL: feed.URL, Category: strings.Join(feed.Categories, ",")})
+	}
+
+	if data, err = xml.MarshalIndent(doc, "", "  "); err != nil {
+		return
+	}
+	data = append([]byte(xml.Header), data...)
+	return
+}
+
+// opmlParse returns feed URLs from OPML document, nested groups of feeds are flattened
+func opmlParse(data []byte) (urls []string, err error) {
+	var doc OPML
+	if err = xml.Unmarshal(data, &doc); err != nil {
+		return
+	}
+
+	var walk func(outlines []OPMLOutline)
+	walk = func(outlines []OPMLOutline) {
+		for _, outline := range outlines {
+			if url := strings.TrimSpace(outline.XMLURL); url != "" {
+				urls = appendStringToSliceIfNotFound(urls, url)
+			}
+			walk(outline.Outlines)
+		}
+	}
+	walk(doc.Body.Outlines)
+	return
+}
+
+// opmlChatFeeds returns feeds of chat, all feeds are returned if chat has no subscriptions
+func opmlChatFeeds(chatID int64) (feeds []Feeder, err error) {
+	if feeds, err = dbGetChatFeeds(chatID); err != nil || len(feeds) > 0 {
+		return
+	}
+	feeds, err = dbGetAllFeeds()
+	return
+}
+
+func commandsExportFeedsHandler(msg *tgbotapi.Message) {
+	feeds, err := opmlChatFeeds(msg.Chat.ID)
+	if err != nil {
+		log.Errorf("Unable to get feeds of chat %d: %s", msg.Chat.ID, err)
+		return
+	}
+	if len(feeds) == 0 {
+		sendMessage(msg.Chat.ID, tr(msg, "opml.no_feeds"), msg.MessageID)
+		return
+	}
+
+	data, err := opmlExport(feeds, tr(msg, "opml.title"))
+	if err != nil {
+		log.Errorf("Unable to build OPML for chat %d: %s", msg.Chat.ID, err)
+		sendMessage(msg.Chat.ID, tr(msg, "common.error"), msg.MessageID)
+		return
+	}
+
+	if err = sendDocument(msg.Chat.ID, opmlFileName, data, msg.MessageID); err != nil {
+		log.Errorf("Unable to send OPML to chat %d: %s", msg.Chat.ID, err)
+	}
+}
+
+func commandsImportFeedsHandler(msg *tgbotapi.Message) {
+	if msg.Document == nil {
+		sendMessage(msg.Chat.ID, tr(msg, "opml.file_required"), msg.MessageID)
+		return
+	}
+
+	data, err := opmlDownload(msg.Document.FileID)
+	if err != nil {
+		log.Errorf("Unable to download OPML file %s: %s", msg.Document.FileID, err)
+		sendMessage(msg.Chat.ID, tr(msg, "opml.download_error"), msg.MessageID)
+		return
+	}
+	urls, err := opmlParse(data)
+	if err != nil {
+		sendMessage(msg.Chat.ID, tr(msg, "opml.parse_error", err), msg.MessageID)
+		return
+	}
+	if len(urls) == 0 {
+		sendMessage(msg.Chat.ID, tr(msg, "opml.empty"), msg.MessageID)
+		return
+	}
+
+	var added, present, failed []string
+	for _, url := range urls {
+		if err = feedAdd(url, msg.Chat.ID, msg.From.ID, 0); err == ErrorSubscriptionAlreadyExists {
+			present = append(present, url)
+		} else if err != nil {
+			log.Warnf("Unable to import feed [%s]: %s", url, err)
+			failed = append(failed, fmt.Sprintf("%s (%s)", url, err))
+		} else {
+			added = append(added, url)
+		}
+	}
+
+	report := []string{tr(msg, "opml.report", len(added), len(present), len(failed))}
+	for _, list := range []struct {
+		title string
+		urls  []string
+	}{{tr(msg, "opml.added"), added}, {tr(msg, "opml.present"), present}, {tr(msg, "opml.failed"), failed}} {
+		if len(list.urls) > 0 {
+			report = append(report, fmt.Sprintf("\n%s:\n%s", list.title, strings.Join(list.urls, "\n")))
+		}
+	}
+	sendMessage(msg.Chat.ID, strings.Join(report, "\n"), msg.MessageID)
+}
+
+// opmlDownload downloads document from Telegram, size of document is limited by maximum size of feed
+func opmlDownload(fileID string) (data []byte, err error) {
+	var (
+		link string
+		resp *http.Response
+	)
+	if link, err = bot.GetFileDirectURL(fileID); err != nil {
+		return
+	}
+	if resp, err = http.Get(link); err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("unexpected status %s", resp.Status)
+		return
+	}
+	if data, err = ioutil.ReadAll(io.LimitReader(resp.Body, options.FeedsMaxSize+1)); err != nil {
+		return
+	}
+	if int64(len(data)) > options.FeedsMaxSize {
+		err = fmt.Errorf("file is larger than %d bytes", options.FeedsMaxSize)
+	}
+	return
+}
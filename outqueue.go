@@ -0,0 +1,238 @@
+// -*- Go -*-
+/* ------------------------------------------------ */
+/* Golang source                                    */
+/* Author: Alexei Panov <me@elemc.name> 			*/
+/* ------------------------------------------------ */
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+// OutgoingPriority is a type for priority of outgoing request, lower value is sent first
+type OutgoingPriority int
+
+// Priorities of outgoing requests
+const (
+	OutgoingPriorityHigh OutgoingPriority = iota // command replies
+	OutgoingPriorityLow                          // pulse broadcasts
+	outgoingPriorities
+)
+
+const (
+	outgoingIdleWait = time.Minute
+)
+
+type outgoingRequest struct {
+	chatID   int64
+	priority OutgoingPriority
+	send     func() error
+	attempts int
+	queued   time.Time
+	result   chan error
+}
+
+// OutgoingMetrics is a type for counters of outgoing queue
+type OutgoingMetrics struct {
+	Sent        int64
+	Failed      int64
+	Retries     int64
+	RateLimited int64
+	WaitSeconds float64
+}
+
+// OutgoingQueue type is a central queue of requests to Telegram API. It limits rate of requests globally and per chat,
+// only one request for chat is running at the same time.
+type OutgoingQueue struct {
+	queues   [outgoingPriorities][]*outgoingRequest
+	busy     map[int64]bool
+	readyAt  map[int64]time.Time
+	globalAt time.Time
+	metrics  OutgoingMetrics
+	wakeup   chan struct{}
+	mutex    sync.Mutex
+}
+
+var (
+	outgoing = OutgoingQueue{
+		busy:    make(map[int64]bool),
+		readyAt: make(map[int64]time.Time),
+		wakeup:  make(chan struct{}, 1),
+	}
+)
+
+// Do function queues request and waits for its result
+func (q *OutgoingQueue) Do(chatID int64, priority OutgoingPriority, send func() error) error {
+	req := &outgoingRequest{
+		chatID:   chatID,
+		priority: priority,
+		send:     send,
+		queued:   time.Now(),
+		result:   make(chan error, 1),
+	}
+	q.mutex.Lock()
+	q.queues[priority] = append(q.queues[priority], req)
+	q.mutex.Unlock()
+	q.notify()
+	return <-req.result
+}
+
+func (q *OutgoingQueue) notify() {
+	select {
+	case q.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// Run function dispatches queued requests
+func (q *OutgoingQueue) Run() {
+	for {
+		req, wait := q.next()
+		if req == nil {
+			select {
+			case <-q.wakeup:
+			case <-time.After(wait):
+			}
+			continue
+		}
+		go q.execute(req)
+	}
+}
+
+// next function returns first request with highest priority for chat which is ready, or time to wait for it
+func (q *OutgoingQueue) next() (req *outgoingRequest, wait time.Duration) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	now := time.Now()
+	// past limits of chats do not limit anything, they are dropped to not keep all chats forever
+	for chatID, readyAt := range q.readyAt {
+		if !now.Before(readyAt) {
+			delete(q.readyAt, chatID)
+		}
+	}
+	if now.Before(q.globalAt) {
+		return nil, q.globalAt.Sub(now)
+	}
+
+	wait = outgoingIdleWait
+	for p := range q.queues {
+		for i, r := range q.queues[p] {
+			if q.busy[r.chatID] {
+				continue
+			}
+			if readyAt := q.readyAt[r.chatID]; now.Before(readyAt) {
+				if readyAt.Sub(now) < wait {
+					wait = readyAt.Sub(now)
+				}
+				continue
+			}
+
+			q.queues[p] = append(q.queues[p][:i], q.queues[p][i+1:]...)
+			q.busy[r.chatID] = true
+			q.readyAt[r.chatID] = now.Add(outgoingChatInterval(r.chatID))
+			if options.OutgoingGlobalRate > 0 {
+				q.globalAt = now.Add(time.Duration(float64(time.Second) / options.OutgoingGlobalRate))
+			}
+			if r.attempts == 0 {
+				q.metrics.WaitSeconds += now.Sub(r.queued).Seconds()
+			}
+			return r, 0
+		}
+	}
+	return nil, wait
+}
+
+// execute function runs request, it is queued again if Telegram asks to retry later or request failed by network error
+func (q *OutgoingQueue) execute(req *outgoingRequest) {
+	err := req.send()
+
+	q.mutex.Lock()
+	delete(q.busy, req.chatID)
+	retry := false
+	if apiErr, ok := err.(tgbotapi.Error); ok && apiErr.RetryAfter > 0 {
+		q.metrics.RateLimited++
+		q.readyAt[req.chatID] = time.Now().Add(time.Duration(apiErr.RetryAfter) * time.Second)
+		retry = req.attempts < options.OutgoingRetries
+		log.Warnf("Too many requests to chat %d, retry after %d seconds", req.chatID, apiErr.RetryAfter)
+	} else if err != nil && !ok && req.attempts < options.OutgoingRetries {
+		q.readyAt[req.chatID] = time.Now().Add(time.Second << uint(req.attempts))
+		retry = true
+		log.Warnf("Unable to send request to chat %d, it will be retried: %s", req.chatID, err)
+	}
+
+	if retry {
+		req.attempts++
+		q.metrics.Retries++
+		q.queues[req.priority] = append([]*outgoingRequest{req}, q.queues[req.priority]...)
+	} else if err != nil {
+		q.metrics.Failed++
+	} else {
+		q.metrics.Sent++
+	}
+	q.mutex.Unlock()
+
+	if !retry {
+		req.result <- err
+	}
+	q.notify()
+}
+
+// Metrics function returns metrics of queue in Prometheus text format
+func (q *OutgoingQueue) Metrics() string {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	lines := []string{
+		"# TYPE gotelegrambot_outgoing_queue_length gauge",
+		fmt.Sprintf(`gotelegrambot_outgoing_queue_length{priority="high"} %d`, len(q.queues[OutgoingPriorityHigh])),
+		fmt.Sprintf(`gotelegrambot_outgoing_queue_length{priority="low"} %d`, len(q.queues[OutgoingPriorityLow])),
+		"# TYPE gotelegrambot_outgoing_in_flight gauge",
+		fmt.Sprintf("gotelegrambot_outgoing_in_flight %d", len(q.busy)),
+		"# TYPE gotelegrambot_outgoing_sent_total counter",
+		fmt.Sprintf("gotelegrambot_outgoing_sent_total %d", q.metrics.Sent),
+		"# TYPE gotelegrambot_outgoing_failed_total counter",
+		fmt.Sprintf("gotelegrambot_outgoing_failed_total %d", q.metrics.Failed),
+		"# TYPE gotelegrambot_outgoing_retries_total counter",
+		fmt.Sprintf("gotelegrambot_outgoing_retries_total %d", q.metrics.Retries),
+		"# TYPE gotelegrambot_outgoing_rate_limited_total counter",
+		fmt.Sprintf("gotelegrambot_outgoing_rate_limited_total %d", q.metrics.RateLimited),
+		"# TYPE gotelegrambot_outgoing_wait_seconds_total counter",
+		fmt.Sprintf("gotelegrambot_outgoing_wait_seconds_total %f", q.metrics.WaitSeconds),
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// outgoingChatInterval returns minimal interval between messages to chat, groups have negative IDs and stricter limits
+func outgoingChatInterval(chatID int64) time.Duration {
+	if chatID < 0 {
+		return options.OutgoingGroupInterval
+	}
+	return options.OutgoingChatInterval
+}
+
+// botSend sends request to Telegram API through outgoing queue
+func botSend(c tgbotapi.Chattable, chatID int64, priority OutgoingPriority) (msg tgbotapi.Message, err error) {
+	err = outgoing.Do(chatID, priority, func() (err error) {
+		msg, err = bot.Send(c)
+		return
+	})
+	return
+}
+
+// botRequest makes request to Telegram API method through outgoing queue
+func botRequest(endpoint string, params url.Values, chatID int64, priority OutgoingPriority) (resp tgbotapi.APIResponse, err error) {
+	err = outgoing.Do(chatID, priority, func() (err error) {
+		resp, err = bot.MakeRequest(endpoint, params)
+		return
+	})
+	return
+}
@@ -0,0 +1,233 @@
+// -*- Go -*-
+/* ------------------------------------------------ */
+/* Golang source                                    */
+/* Author: Alexei Panov <me@elemc.name> 			*/
+/* ------------------------------------------------ */
+
+package main
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+const (
+	slowModeSweepPeriod = 10 * time.Minute
+)
+
+// ChatSettingsMemory type is a thread-safe chat settings cache
+type ChatSettingsMemory struct {
+	cache map[int64]ChatSettings
+	mutex sync.RWMutex
+}
+
+// SlowModeTracker type stores time of last message for each member of chat
+type SlowModeTracker struct {
+	last  map[int64]map[int]time.Time
+	mutex sync.Mutex
+}
+
+// LocationMemory type is a thread-safe cache of loaded time zones
+type LocationMemory struct {
+	cache map[string]*time.Location
+	mutex sync.RWMutex
+}
+
+var (
+	chatSettings = ChatSettingsMemory{cache: make(map[int64]ChatSettings)}
+	slowMode     = SlowModeTracker{last: make(map[int64]map[int]time.Time)}
+	locations    = LocationMemory{cache: make(map[string]*time.Location)}
+)
+
+// Get function returns time zone by name, it is loaded once
+func (lm *LocationMemory) Get(name string) (location *time.Location, err error) {
+	var ok bool
+	lm.mutex.RLock()
+	location, ok = lm.cache[name]
+	lm.mutex.RUnlock()
+	if ok {
+		return
+	}
+
+	if location, err = time.LoadLocation(name); err != nil {
+		return
+	}
+	lm.mutex.Lock()
+	lm.cache[name] = location
+	lm.mutex.Unlock()
+	return
+}
+
+// Get function returns chat settings from cache or database
+func (cs *ChatSettingsMemory) Get(chatID int64) (settings ChatSettings, err error) {
+	var ok bool
+	cs.mutex.RLock()
+	settings, ok = cs.cache[chatID]
+	cs.mutex.RUnlock()
+	if ok {
+		return
+	}
+
+	if settings, err = dbGetChatSettings(chatID); err != nil {
+		return
+	}
+	cs.mutex.Lock()
+	cs.cache[chatID] = settings
+	cs.mutex.Unlock()
+	return
+}
+
+// Set function stores chat settings in database and cache
+func (cs *ChatSettingsMemory) Set(settings ChatSettings) (err error) {
+	if err = dbSaveChatSettings(settings); err != nil {
+		return
+	}
+	cs.mutex.Lock()
+	cs.cache[settings.ChatID] = settings
+	cs.mutex.Unlock()
+	return
+}
+
+// Location function returns time zone of chat
+func (settings ChatSettings) Location() *time.Location {
+	if settings.Timezone == "" {
+		return time.Local
+	}
+	location, err := locations.Get(settings.Timezone)
+	if err != nil {
+		log.Warnf("Unable to load time zone %s for chat %d: %s", settings.Timezone, settings.ChatID, err)
+		return time.Local
+	}
+	return location
+}
+
+// IsNight function checks that night mode is active right now in chat time zone
+func (settings ChatSettings) IsNight() bool {
+	if !settings.NightMode {
+		return false
+	}
+	return hourInRange(time.Now().In(settings.Location()).Hour(), settings.NightModeStart, settings.NightModeEnd)
+}
+
+// IsQuiet function checks that quiet hours of pulse are active right now in chat time zone
+func (settings ChatSettings) IsQuiet() bool {
+	if !settings.QuietHours {
+		return false
+	}
+	return hourInRange(time.Now().In(settings.Location()).Hour(), settings.QuietStart, settings.QuietEnd)
+}
+
+// hourInRange checks hour in [start, end) range, range may wrap around midnight
+func hourInRange(hour, start, end int) bool {
+	if start <= end {
+		return hour >= start && hour < end
+	}
+	return hour >= start || hour < end
+}
+
+// Allow function checks and updates time of last message for user in chat
+func (sm *SlowModeTracker) Allow(chatID int64, userID int, period time.Duration) bool {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	users, ok := sm.last[chatID]
+	if !ok {
+		users = make(map[int]time.Time)
+		sm.last[chatID] = users
+	}
+	if last, ok := users[userID]; ok && time.Since(last) < period {
+		return false
+	}
+	users[userID] = time.Now()
+	return true
+}
+
+// slowModeSweep periodically removes messages which are older than slow mode period of their chats
+func slowModeSweep() {
+	for {
+		time.Sleep(slowModeSweepPeriod)
+		if count := slowMode.Sweep(); count > 0 {
+			log.Debugf("%d expired slow mode messages removed", count)
+		}
+	}
+}
+
+// Sweep function removes times of messages which can't restrict members anymore, chats without them are removed too
+func (sm *SlowModeTracker) Sweep() (count int) {
+	sm.mutex.Lock()
+	chats := make([]int64, 0, len(sm.last))
+	for chatID := range sm.last {
+		chats = append(chats, chatID)
+	}
+	sm.mutex.Unlock()
+
+	for _, chatID := range chats {
+		// settings are got without lock as they can be loaded from database
+		settings, err := chatSettings.Get(chatID)
+		if err != nil {
+			log.Errorf("Unable to get settings of chat %d: %s", chatID, err)
+			continue
+		}
+		period := time.Duration(settings.SlowModeSeconds) * time.Second
+
+		sm.mutex.Lock()
+		users := sm.last[chatID]
+		for userID, last := range users {
+			if time.Since(last) >= period {
+				delete(users, userID)
+				count++
+			}
+		}
+		if len(users) == 0 {
+			delete(sm.last, chatID)
+		}
+		sm.mutex.Unlock()
+	}
+	return
+}
+
+func messageHasMedia(msg *tgbotapi.Message) bool {
+	return msg.Audio != nil || msg.Document != nil || msg.Photo != nil || msg.Sticker != nil || msg.Video != nil ||
+		msg.VideoNote != nil || msg.Voice != nil || msg.Animation != nil
+}
+
+// chatPoliciesViolated deletes message which violates slow or night mode of chat, returns true if message is deleted
+func chatPoliciesViolated(msg *tgbotapi.Message) bool {
+	if msg.Chat == nil || msg.From == nil || (!msg.Chat.IsGroup() && !msg.Chat.IsSuperGroup()) {
+		return false
+	}
+	if msg.NewChatMembers != nil || msg.LeftChatMember != nil {
+		return false
+	}
+
+	settings, err := chatSettings.Get(msg.Chat.ID)
+	if err != nil {
+		log.Errorf("Unable to get settings for chat %d: %s", msg.Chat.ID, err)
+		return false
+	}
+
+	reason := ""
+	if settings.IsNight() && messageHasMedia(msg) {
+		reason = "night mode"
+	} else if settings.SlowModeSeconds > 0 && !slowMode.Allow(msg.Chat.ID, msg.From.ID, time.Duration(settings.SlowModeSeconds)*time.Second) {
+		reason = "slow mode"
+	}
+	if reason == "" {
+		return false
+	}
+
+	// admins are not limited by chat policies, it is checked only for violating messages as it is request to Telegram API
+	if isUserAdmin(msg.Chat, msg.From) {
+		return false
+	}
+
+	if _, err = bot.DeleteMessage(tgbotapi.DeleteMessageConfig{ChatID: msg.Chat.ID, MessageID: msg.MessageID}); err != nil {
+		log.Warnf("Unable to delete message %d in chat %d (%s): %s", msg.MessageID, msg.Chat.ID, reason, err)
+		return false
+	}
+	log.Debugf("Message %d from %s in chat %d deleted by %s", msg.MessageID, msg.From.String(), msg.Chat.ID, reason)
+	return true
+}
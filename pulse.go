@@ -7,17 +7,24 @@
 package main
 
 import (
-	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
 	"html"
+	"sort"
+	"strings"
 	"sync"
-	"text/template"
 	"time"
 
 	"github.com/mmcdole/gofeed"
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	feedNewsRetentionPeriod = time.Hour
+)
+
 // FeedLocks is a type for locking feeders
 type FeedLocks struct {
 	locks map[string]bool
@@ -28,21 +35,107 @@ var (
 	feedLocks = FeedLocks{locks: make(map[string]bool)}
 )
 
-func feedAdd(url string) (err error) {
-	var feed *gofeed.Feed
-	parser := gofeed.NewParser()
-	if feed, err = parser.ParseURL(url); err != nil {
+// feedAdd subscribes chat to feed, feed is added to database if it is not exists. Current items of new feed are marked
+// as seen to not flood chats with backlog, last most recent items are sent to chat anyway.
+func feedAdd(url string, chatID int64, userID int, last int) (err error) {
+	var (
+		exists bool
+		fd     *gofeed.Feed
+	)
+	if exists, err = dbFeedExists(url); err != nil {
+		return
+	}
+	if !exists || last > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), options.FeedsDeadline)
+		defer cancel()
+		if fd, err = feedFetch(ctx, &Feeder{URL: url}); err != nil {
+			return
+		}
+		if fd == nil {
+			err = fmt.Errorf("unexpected not modified answer")
+			return
+		}
+	}
+	if !exists {
+		// items are marked before feed is added, otherwise scheduler can poll new feed and send its backlog
+		feedMarkSeen(url, fd)
+		if err = dbAddFeed(url, fd.Title); err != nil {
+			return
+		}
+	}
+
+	if err = dbAddFeedSubscription(FeedSubscription{
+		FeedURL:   url,
+		ChatID:    chatID,
+		AddedBy:   userID,
+		CreatedAt: time.Now(),
+	}); err != nil {
 		return
 	}
-	err = dbAddFeed(url, feed.Title)
+	if last > 0 {
+		feedSendLast(fd, url, chatID, last)
+	}
 	return
 }
 
-func feedDel(url string) (err error) {
+// feedMarkSeen stores all items of feed as already sent news
+func feedMarkSeen(url string, fd *gofeed.Feed) {
+	for _, item := range fd.Items {
+		if item == nil {
+			continue
+		}
+		news := feedNewsFromItem(url, fd, item)
+		if news.GUID == "" || feedNewsSeen(news, fd, item) {
+			continue
+		}
+		if err := dbNewsAdd(news); err != nil {
+			log.Errorf("Unable to insert news to database: %s", err)
+		}
+	}
+}
+
+// feedSendLast sends last most recent items of feed to chat from older to newer
+func feedSendLast(fd *gofeed.Feed, url string, chatID int64, last int) {
+	var news []FeedNews
+	for _, item := range fd.Items {
+		if item != nil {
+			news = append(news, feedNewsFromItem(url, fd, item))
+		}
+	}
+	sort.SliceStable(news, func(i, j int) bool { return news[i].Published.After(news[j].Published) })
+	if len(news) > last {
+		news = news[:last]
+	}
+
+	templates, err := dbGetFeedTemplates(url)
+	if err != nil {
+		log.Errorf("Unable to get templates of feed %s: %s", url, err)
+	}
+	tmpl := feedTemplateFor(templates, url, chatID)
+	for i := len(news) - 1; i >= 0; i-- {
+		text, err := feedRenderNews(tmpl, news[i])
+		if err != nil {
+			log.Errorf("Unable to execute template of feed %s for chat %d: %s", url, chatID, err)
+			return
+		}
+		feedSendNews(chatID, text, news[i].Images(), false)
+	}
+}
+
+// feedDel unsubscribes chat from feed, feed is removed from database if nobody is subscribed to it
+func feedDel(url string, chatID int64) (err error) {
+	var subs []FeedSubscription
+	if err = dbDelFeedSubscription(url, chatID); err != nil {
+		return
+	}
+	if subs, err = dbGetFeedSubscriptions(url); err != nil || len(subs) > 0 {
+		return
+	}
 	err = dbDelFeed(url)
 	return
 }
 
+// updateFeeds polls due feeds concurrently, first poll runs immediately at startup
 func updateFeeds() {
 	var (
 		feeds []Feeder
@@ -50,16 +143,29 @@ func updateFeeds() {
 	)
 	defer wg.Done()
 
+	tick := time.Minute
+	if options.FeedsUpdatePeriod < tick {
+		tick = options.FeedsUpdatePeriod
+	}
+	slots := make(chan struct{}, options.FeedsConcurrency)
+
 	for {
-		time.Sleep(options.FeedsUpdatePeriod)
 		if feeds, err = dbGetAllFeeds(); err != nil {
 			log.Errorf("Unable to get all feeds: %s", err)
-			continue
 		}
 		for _, feed := range feeds {
-			log.Debugf("Update feed %s (%s)", feed.Name, feed.URL)
-			updateFeed(feed)
+			if feed.Disabled || time.Now().Before(feed.NextUpdate) || feedLocks.getFeedLock(feed) {
+				continue
+			}
+
+			slots <- struct{}{}
+			go func(feed Feeder) {
+				defer func() { <-slots }()
+				log.Debugf("Update feed %s (%s)", feed.Name, feed.URL)
+				updateFeed(feed)
+			}(feed)
 		}
+		time.Sleep(tick)
 	}
 }
 
@@ -74,85 +180,207 @@ func updateFeed(feed Feeder) {
 		return
 	}
 
-	if feedLocks.getFeedLock(feed) { // is locked, skip it
+	if !feedLocks.tryLockFeeder(feed) { // is locked, skip it
 		log.Debugf("Skip feed %s, its running now", feed.URL)
 		return
 	}
-
-	feedLocks.lockFeeder(feed)
 	defer feedLocks.unlockFeeder(feed)
 
-	parser := gofeed.NewParser()
-	if fd, err = parser.ParseURL(feed.URL); err != nil {
-		log.Errorf("Unable to parse feed URL [%s]: %s", feed.URL, err)
+	ctx, cancel := context.WithTimeout(context.Background(), options.FeedsDeadline)
+	defer cancel()
+
+	itemCount, newItems := -1, 0
+	defer func() {
+		feedScheduleNext(&feed, err != nil, newItems)
+		if feedRecordHealth(&feed, err, itemCount, newItems) {
+			go feedNotifyDisabled(feed)
+		}
+		if err := dbUpdateFeedPoll(&feed); err != nil {
+			log.Errorf("Unable to update feed %s: %s", feed.URL, err)
+		}
+	}()
+
+	if fd, err = feedFetch(ctx, &feed); err != nil {
+		log.Errorf("Unable to fetch feed URL [%s]: %s", feed.URL, err)
 		return
 	}
 	if fd == nil {
-		log.Warnf("Feeder for %s is nil", feed.URL)
+		log.Debugf("Feed %s is not modified", feed.URL)
+		return
+	}
+	itemCount = len(fd.Items)
+
+	var delivery *FeedDelivery
+	if delivery, err = newFeedDelivery(feed.URL); err != nil {
+		log.Errorf("Unable to load subscribers of feed %s: %s", feed.URL, err)
 		return
 	}
 
+	var undated []string
 	for _, item := range fd.Items {
+		if ctx.Err() != nil {
+			log.Warnf("Deadline of feed %s exceeded, rest of items will be processed next time", feed.URL)
+			break
+		}
 		if item == nil {
 			log.Warnf("Item for feeder %s is nil", feed.URL)
 			continue
 		}
-		news := feedNewsFromItem(fd, item)
+		news := feedNewsFromItem(feed.URL, fd, item)
 
-		if news.URL == "" {
-			log.Warnf("News with empty URL for feed %s", feed.URL)
+		if news.GUID == "" {
+			log.Warnf("News without GUID, link and content for feed %s", feed.URL)
+			continue
+		}
+		if feedNewsExpired(news) { // this news is too old, skip it
 			continue
 		}
-		if dbNewsFound(news) { // this news is found, skip it
+		if feedNewsSeen(news, fd, item) { // this news is found, undated news are kept while they are in feed
+			if news.Published.IsZero() {
+				undated = append(undated, news.GUID)
+			}
 			continue
 		}
 
-		if err = dbNewsAdd(news); err != nil {
+		if err := dbNewsAdd(news); err != nil {
 			log.Errorf("Unable to insert news to database: %s", err)
 			continue
 		}
-		sendMessageToAllChats(news.String())
+		newItems++
+		delivery.Send(news)
+	}
+
+	if len(undated) > 0 {
+		if err := dbNewsTouch(feed.URL, undated); err != nil {
+			log.Errorf("Unable to renew undated news of feed %s: %s", feed.URL, err)
+		}
+	}
+}
+
+// feedNewsKey returns deduplication key of item in feed: GUID, link or hash of content if item has no GUID and link
+func feedNewsKey(item *gofeed.Item) string {
+	if item.GUID != "" {
+		return item.GUID
 	}
+	if item.Link != "" {
+		return item.Link
+	}
+	if item.Title == "" && item.Description == "" && item.Content == "" {
+		return ""
+	}
+	sum := sha1.Sum([]byte(item.Title + "\n" + item.Description + "\n" + item.Content))
+	return "sha1:" + hex.EncodeToString(sum[:])
 }
 
-func feedNewsFromItem(fd *gofeed.Feed, item *gofeed.Item) FeedNews {
+// feedNewsSeen checks news by its key, by link in all feeds if it is enabled and by key of previous versions
+// which was site link with GUID
+func feedNewsSeen(news FeedNews, fd *gofeed.Feed, item *gofeed.Item) bool {
+	if dbNewsFound(news) {
+		return true
+	}
+	if options.FeedsDedupByLink && news.Link != "" && dbNewsLinkFound(news.Link) {
+		return true
+	}
+	if fd != nil && item != nil && fd.Link != "" && item.GUID != "" && fd.Link != news.URL {
+		return dbNewsFound(FeedNews{URL: fd.Link, GUID: item.GUID})
+	}
+	return false
+}
+
+// feedNewsExpired checks that news is published before retention period, such news would be pruned soon
+// and sent again, so they are skipped. Undated news are never expired, instead they are marked as seen on every poll
+// while they are present in feed, so retention prunes them only after they leave feed.
+func feedNewsExpired(news FeedNews) bool {
+	return options.FeedsRetention > 0 && !news.Published.IsZero() && time.Since(news.Published) > options.FeedsRetention
+}
+
+// feedNewsRetention prunes news stored longer than retention period
+func feedNewsRetention() {
+	if options.FeedsRetention <= 0 {
+		log.Debugf("News retention is disabled, skip it")
+		return
+	}
+
+	for {
+		if count, err := dbNewsPrune(time.Now().Add(-options.FeedsRetention)); err != nil {
+			log.Errorf("Unable to prune old news: %s", err)
+		} else if count > 0 {
+			log.Debugf("%d old news pruned", count)
+		}
+		time.Sleep(feedNewsRetentionPeriod)
+	}
+}
+
+func feedNewsFromItem(url string, fd *gofeed.Feed, item *gofeed.Item) FeedNews {
 	if fd == nil || item == nil {
 		return FeedNews{}
 	}
 	news := FeedNews{
-		URL:         fd.Link,
-		GUID:        item.GUID,
+		URL:         url,
+		GUID:        feedNewsKey(item),
 		Title:       item.Title,
 		Link:        item.Link,
 		Description: html.EscapeString(item.Description),
 		FeedTitle:   fd.Title,
+		CreatedAt:   time.Now(),
 	}
 	if item.Image != nil {
 		news.ImageURL = item.Image.URL
 		news.ImageTitle = item.Image.Title
 	}
+	if item.Author != nil {
+		news.Author = item.Author.Name
+	}
+	if item.PublishedParsed != nil {
+		news.Published = *item.PublishedParsed
+	} else if item.UpdatedParsed != nil {
+		news.Published = *item.UpdatedParsed
+	}
+	news.Categories = item.Categories
+	for _, enclosure := range item.Enclosures {
+		if enclosure == nil {
+			continue
+		}
+		news.Enclosures = append(news.Enclosures, FeedEnclosure{URL: enclosure.URL, Type: enclosure.Type, Length: enclosure.Length})
+	}
+	media := item.Extensions["media"]
+	contents := media["content"]
+	for _, group := range media["group"] {
+		contents = append(contents, group.Children["content"]...)
+	}
+	for _, content := range contents {
+		enclosure := FeedEnclosure{URL: content.Attrs["url"], Type: content.Attrs["type"], Length: content.Attrs["fileSize"]}
+		if enclosure.Type == "" && content.Attrs["medium"] == "image" {
+			enclosure.Type = "image"
+		}
+		if enclosure.URL != "" {
+			news.Enclosures = append(news.Enclosures, enclosure)
+		}
+	}
 	return news
 }
 
-func (fn *FeedNews) String() string {
-	tmplText := `*{{ .FeedTitle }}*
-[{{ .Title }}]({{ .Link }})`
-	tmpl, err := template.New("message").Parse(tmplText)
-	if err != nil {
-		log.Errorf("Unable to parse template: %s", err)
-		return ""
+// Images function returns URLs of news image, image enclosures and media content without duplicates
+func (fn *FeedNews) Images() (images []string) {
+	if fn.ImageURL != "" {
+		images = append(images, fn.ImageURL)
 	}
-
-	var buf bytes.Buffer
-	if err = tmpl.Execute(&buf, fn); err != nil {
-		log.Errorf("Unable to execute template: %s", err)
+	for _, enclosure := range fn.Enclosures {
+		if strings.HasPrefix(enclosure.Type, "image") {
+			images = appendStringToSliceIfNotFound(images, enclosure.URL)
+		}
 	}
-
-	text := buf.String()
-	if fn.ImageURL != "" {
-		text = fmt.Sprintf("%s\n[%s](%s)", text, fn.ImageTitle, fn.ImageURL)
+	if len(images) > mediaGroupMaxSize {
+		images = images[:mediaGroupMaxSize]
 	}
+	return
+}
 
+func (fn *FeedNews) String() string {
+	text, err := feedRenderNews(feedTemplateFor(nil, "", 0), *fn)
+	if err != nil {
+		log.Errorf("Unable to execute template: %s", err)
+	}
 	return text
 }
 
@@ -172,8 +400,15 @@ func (fl *FeedLocks) lockUnlockFeeder(feed Feeder, lock bool) {
 	fl.locks[feed.URL] = lock
 }
 
-func (fl *FeedLocks) lockFeeder(feed Feeder) {
-	fl.lockUnlockFeeder(feed, true)
+// tryLockFeeder locks feeder if it is not locked yet and returns true on success
+func (fl *FeedLocks) tryLockFeeder(feed Feeder) bool {
+	fl.mutex.Lock()
+	defer fl.mutex.Unlock()
+	if fl.locks[feed.URL] {
+		return false
+	}
+	fl.locks[feed.URL] = true
+	return true
 }
 
 func (fl *FeedLocks) unlockFeeder(feed Feeder) {
@@ -0,0 +1,343 @@
+// -*- Go -*-
+/* ------------------------------------------------ */
+/* Golang source                                    */
+/* Author: Alexei Panov <me@elemc.name> 			*/
+/* ------------------------------------------------ */
+
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	pulseFeedPageSize = 50
+)
+
+// PulseFeed is a type for page of stored news which is published over HTTP
+type PulseFeed struct {
+	Title   string
+	Link    string
+	Self    string
+	Next    string
+	Updated time.Time
+	News    []FeedNews
+}
+
+// AtomFeed is a type for Atom document
+type AtomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []AtomLink  `xml:"link"`
+	Entries []AtomEntry `xml:"entry"`
+}
+
+// AtomLink is a type for link of Atom document or entry
+type AtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+// AtomEntry is a type for entry of Atom document
+type AtomEntry struct {
+	Title     string       `xml:"title"`
+	ID        string       `xml:"id"`
+	Updated   string       `xml:"updated"`
+	Published string       `xml:"published,omitempty"`
+	Links     []AtomLink   `xml:"link"`
+	Author    *AtomAuthor  `xml:"author,omitempty"`
+	Content   *AtomContent `xml:"content,omitempty"`
+}
+
+// AtomAuthor is a type for author of Atom entry
+type AtomAuthor struct {
+	Name string `xml:"name"`
+}
+
+// AtomContent is a type for content of Atom entry
+type AtomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// RSSFeed is a type for RSS 2.0 document
+type RSSFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel RSSChannel `xml:"channel"`
+}
+
+// RSSChannel is a type for channel of RSS document
+type RSSChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []RSSItem `xml:"item"`
+}
+
+// RSSItem is a type for item of RSS document
+type RSSItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link,omitempty"`
+	Description string   `xml:"description,omitempty"`
+	Author      string   `xml:"author,omitempty"`
+	Categories  []string `xml:"category"`
+	GUID        RSSGUID  `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+}
+
+// RSSGUID is a type for GUID of RSS item
+type RSSGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// JSONFeed is a type for JSON Feed document
+type JSONFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url,omitempty"`
+	FeedURL     string         `json:"feed_url"`
+	NextURL     string         `json:"next_url,omitempty"`
+	Items       []JSONFeedItem `json:"items"`
+}
+
+// JSONFeedItem is a type for item of JSON Feed document
+type JSONFeedItem struct {
+	ID            string          `json:"id"`
+	URL           string          `json:"url,omitempty"`
+	Title         string          `json:"title"`
+	ContentHTML   string          `json:"content_html,omitempty"`
+	Image         string          `json:"image,omitempty"`
+	DatePublished string          `json:"date_published"`
+	Author        *JSONFeedAuthor `json:"author,omitempty"`
+	Tags          []string        `json:"tags,omitempty"`
+}
+
+// JSONFeedAuthor is a type for author of JSON Feed item
+type JSONFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+// ID function returns unique identifier of news
+func (fn *FeedNews) ID() string {
+	sum := sha1.Sum([]byte(fn.URL + "\n" + fn.GUID))
+	return "urn:sha1:" + hex.EncodeToString(sum[:])
+}
+
+// Date function returns publication date of news or time when it was stored if feed has no dates
+func (fn *FeedNews) Date() time.Time {
+	if !fn.Published.IsZero() {
+		return fn.Published
+	}
+	return fn.CreatedAt
+}
+
+// Content function returns description of news as HTML, description is stored escaped
+func (fn *FeedNews) Content() string {
+	return html.UnescapeString(fn.Description)
+}
+
+// Atom function builds Atom document of pulse feed
+func (pf *PulseFeed) Atom() ([]byte, error) {
+	doc := AtomFeed{
+		Title:   pf.Title,
+		ID:      pf.Self,
+		Updated: pf.Updated.Format(time.RFC3339),
+		Links:   []AtomLink{{Href: pf.Self, Rel: "self", Type: "application/atom+xml"}, {Href: pf.Link, Rel: "alternate"}},
+	}
+	if pf.Next != "" {
+		doc.Links = append(doc.Links, AtomLink{Href: pf.Next, Rel: "next", Type: "application/atom+xml"})
+	}
+	for _, news := range pf.News {
+		entry := AtomEntry{
+			Title:     news.Title,
+			ID:        news.ID(),
+			Updated:   news.Date().Format(time.RFC3339),
+			Published: news.Date().Format(time.RFC3339),
+			Content:   &AtomContent{Type: "html", Body: news.Content()},
+		}
+		if news.Link != "" {
+			entry.Links = append(entry.Links, AtomLink{Href: news.Link, Rel: "alternate"})
+		}
+		if news.Author != "" {
+			entry.Author = &AtomAuthor{Name: news.Author}
+		}
+		doc.Entries = append(doc.Entries, entry)
+	}
+	return pulseFeedXML(doc)
+}
+
+// RSS function builds RSS 2.0 document of pulse feed
+func (pf *PulseFeed) RSS() ([]byte, error) {
+	doc := RSSFeed{
+		Version: "2.0",
+		Channel: RSSChannel{
+			Title:         pf.Title,
+			Link:          pf.Link,
+			Description:   pf.Title,
+			LastBuildDate: pf.Updated.Format(time.RFC1123Z),
+		},
+	}
+	for _, news := range pf.News {
+		doc.Channel.Items = append(doc.Channel.Items, RSSItem{
+			Title:       news.Title,
+			Link:        news.Link,
+			Description: news.Content(),
+			Author:      news.Author,
+			Categories:  news.Categories,
+			GUID:        RSSGUID{Value: news.ID()},
+			PubDate:     news.Date().Format(time.RFC1123Z),
+		})
+	}
+	return pulseFeedXML(doc)
+}
+
+// JSON function builds JSON Feed document of pulse feed
+func (pf *PulseFeed) JSON() ([]byte, error) {
+	doc := JSONFeed{
+		Version:     "https://jsonfeed.org/version/1",
+		Title:       pf.Title,
+		HomePageURL: pf.Link,
+		FeedURL:     pf.Self,
+		NextURL:     pf.Next,
+		Items:       []JSONFeedItem{},
+	}
+	for _, news := range pf.News {
+		item := JSONFeedItem{
+			ID:            news.ID(),
+			URL:           news.Link,
+			Title:         news.Title,
+			ContentHTML:   news.Content(),
+			Image:         news.ImageURL,
+			DatePublished: news.Date().Format(time.RFC3339),
+			Tags:          news.Categories,
+		}
+		if news.Author != "" {
+			item.Author = &JSONFeedAuthor{Name: news.Author}
+		}
+		doc.Items = append(doc.Items, item)
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+func pulseFeedXML(doc interface{}) (data []byte, err error) {
+	if data, err = xml.MarshalIndent(doc, "", "  "); err != nil {
+		return
+	}
+	data = append([]byte(xml.Header), data...)
+	return
+}
+
+// pulseFeedLoad loads page of stored news, news are filtered by feed and chat from `feed` and `chat` arguments
+func pulseFeedLoad(ctx *fasthttp.RequestCtx) (pf *PulseFeed, err error) {
+	var (
+		chatID int64
+		page   = 1
+	)
+	args := ctx.QueryArgs()
+	feedURL := string(args.Peek("feed"))
+	if args.Has("chat") {
+		if chatID, err = strconv.ParseInt(string(args.Peek("chat")), 10, 64); err != nil {
+			err = fmt.Errorf("chat ID is not integer")
+			return
+		}
+	}
+	if args.Has("page") {
+		if page, err = strconv.Atoi(string(args.Peek("page"))); err != nil || page < 1 {
+			err = fmt.Errorf("page is not positive integer")
+			return
+		}
+	}
+
+	base := fmt.Sprintf("%s://%s", ctx.URI().Scheme(), ctx.URI().Host())
+	pf = &PulseFeed{Title: "Pulse", Link: base + "/feeds"}
+	if feedURL != "" {
+		pf.Title = fmt.Sprintf("Pulse: %s", feedURL)
+		if feed, err := dbGetFeed(feedURL); err == nil && feed.Name != "" {
+			pf.Title = fmt.Sprintf("Pulse: %s", feed.Name)
+		}
+	}
+	if chatID != 0 {
+		pf.Title = fmt.Sprintf("%s (chat %d)", pf.Title, chatID)
+	}
+
+	if pf.News, err = dbGetPulseNews(feedURL, chatID, (page-1)*pulseFeedPageSize, pulseFeedPageSize+1); err != nil {
+		return
+	}
+
+	pageURL := func(page int) string {
+		query := url.Values{}
+		if feedURL != "" {
+			query.Set("feed", feedURL)
+		}
+		if chatID != 0 {
+			query.Set("chat", strconv.FormatInt(chatID, 10))
+		}
+		if page > 1 {
+			query.Set("page", strconv.Itoa(page))
+		}
+		link := base + string(ctx.Path())
+		if len(query) > 0 {
+			link += "?" + query.Encode()
+		}
+		return link
+	}
+	pf.Self = pageURL(page)
+	if len(pf.News) > pulseFeedPageSize {
+		pf.News = pf.News[:pulseFeedPageSize]
+		pf.Next = pageURL(page + 1)
+	}
+
+	pf.Updated = time.Now()
+	if len(pf.News) > 0 {
+		pf.Updated = pf.News[0].CreatedAt
+	}
+	return
+}
+
+func httpPulseFeedHandler(ctx *fasthttp.RequestCtx) {
+	httpInitRequest(ctx)
+	var (
+		err  error
+		pf   *PulseFeed
+		data []byte
+	)
+
+	if pf, err = pulseFeedLoad(ctx); err != nil {
+		httpFinishBadParam(ctx, err.Error())
+		return
+	}
+
+	switch string(ctx.Path()) {
+	case "/pulse.atom":
+		ctx.SetContentType("application/atom+xml; charset=utf-8")
+		data, err = pf.Atom()
+	case "/pulse.rss":
+		ctx.SetContentType("application/rss+xml; charset=utf-8")
+		data, err = pf.RSS()
+	default:
+		ctx.SetContentType("application/feed+json; charset=utf-8")
+		data, err = pf.JSON()
+	}
+	if err != nil {
+		httpFinishError(ctx, err)
+		return
+	}
+	ctx.Write(data)
+	ctx.SetStatusCode(fasthttp.StatusOK)
+}
@@ -0,0 +1,182 @@
+// -*- Go -*-
+/* ------------------------------------------------ */
+/* Golang source                                    */
+/* Author: Alexei Panov <me@elemc.name> 			*/
+/* ------------------------------------------------ */
+
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	pushFeedPrefix    = "push:"
+	pushDefaultSource = "api"
+)
+
+// PushItem is a type for item pushed to pulse over HTTP API
+type PushItem struct {
+	Source      string   `json:"source"`
+	GUID        string   `json:"guid"`
+	Title       string   `json:"title"`
+	Link        string   `json:"link"`
+	Description string   `json:"description"`
+	Image       string   `json:"image"`
+	ImageTitle  string   `json:"image_title"`
+	Author      string   `json:"author"`
+	Categories  []string `json:"categories"`
+	Chats       []int64  `json:"chats"`
+}
+
+// PushResult is a type for response of HTTP API
+type PushResult struct {
+	Status string `json:"status"`
+	Chats  int    `json:"chats,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// pushAuthorized checks token from `Authorization: Bearer` header with tokens from configuration
+func pushAuthorized(ctx *fasthttp.RequestCtx) bool {
+	header := string(ctx.Request.Header.Peek("Authorization"))
+	if !strings.HasPrefix(header, "Bearer ") {
+		return false
+	}
+	token := []byte(strings.TrimSpace(strings.TrimPrefix(header, "Bearer ")))
+	for _, t := range options.APITokens {
+		if t != "" && subtle.ConstantTimeCompare(token, []byte(t)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// News function converts pushed item to news of pseudo feed named by source
+func (item *PushItem) News() FeedNews {
+	source := strings.TrimSpace(item.Source)
+	if source == "" {
+		source = pushDefaultSource
+	}
+	news := FeedNews{
+		URL:         pushFeedPrefix + source,
+		GUID:        item.GUID,
+		Title:       item.Title,
+		Link:        item.Link,
+		Description: html.EscapeString(item.Description),
+		ImageURL:    item.Image,
+		ImageTitle:  item.ImageTitle,
+		FeedTitle:   source,
+		Author:      item.Author,
+		Published:   time.Now(),
+		Categories:  item.Categories,
+		CreatedAt:   time.Now(),
+	}
+	if news.GUID == "" {
+		news.GUID = item.Link
+	}
+	if news.GUID == "" {
+		news.GUID = (&FeedNews{URL: news.URL, GUID: item.Title + "\n" + item.Description}).ID()
+	}
+	if news.ImageURL != "" && news.ImageTitle == "" {
+		news.ImageTitle = news.Title
+	}
+	return news
+}
+
+func httpPushFinish(ctx *fasthttp.RequestCtx, status int, result PushResult) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		httpFinishError(ctx, err)
+		return
+	}
+	ctx.SetContentType("application/json")
+	ctx.Write(data)
+	ctx.SetStatusCode(status)
+}
+
+// httpPushHandler injects pushed item to pulse of target chats with the same deduplication, templates and delivery as feeds
+func httpPushHandler(ctx *fasthttp.RequestCtx) {
+	httpInitRequest(ctx)
+	var (
+		item     PushItem
+		delivery *FeedDelivery
+		err      error
+	)
+
+	if !pushAuthorized(ctx) {
+		log.Warnf("Unauthorized push request from %s", ctx.RemoteIP().String())
+		httpPushFinish(ctx, fasthttp.StatusUnauthorized, PushResult{Status: "error", Error: "unauthorized"})
+		return
+	}
+	if err = json.Unmarshal(ctx.PostBody(), &item); err != nil {
+		httpPushFinish(ctx, fasthttp.StatusBadRequest, PushResult{Status: "error", Error: fmt.Sprintf("invalid JSON: %s", err)})
+		return
+	}
+	if strings.TrimSpace(item.Title) == "" {
+		httpPushFinish(ctx, fasthttp.StatusBadRequest, PushResult{Status: "error", Error: "title is required"})
+		return
+	}
+	if len(item.Chats) == 0 {
+		httpPushFinish(ctx, fasthttp.StatusBadRequest, PushResult{Status: "error", Error: "chats are required"})
+		return
+	}
+	for _, chatID := range item.Chats {
+		if exists, err := dbChatExists(chatID); err != nil {
+			httpFinishError(ctx, err)
+			return
+		} else if !exists {
+			httpPushFinish(ctx, fasthttp.StatusBadRequest, PushResult{Status: "error", Error: fmt.Sprintf("unknown chat %d", chatID)})
+			return
+		}
+	}
+
+	news := item.News()
+	if feedNewsSeen(news, nil, nil) {
+		httpPushFinish(ctx, fasthttp.StatusOK, PushResult{Status: "duplicate"})
+		return
+	}
+	if err = dbNewsAdd(news); err != nil {
+		httpFinishError(ctx, err)
+		return
+	}
+
+	if delivery, err = newFeedDelivery(news.URL); err != nil {
+		httpFinishError(ctx, err)
+		return
+	}
+	if delivery.Subs, err = pushSubscriptions(news.URL, item.Chats); err != nil {
+		httpFinishError(ctx, err)
+		return
+	}
+	delivery.Send(news)
+
+	log.Debugf("Pushed news [%s] from %s sent to %d chats", news.Title, news.URL, len(item.Chats))
+	httpPushFinish(ctx, fasthttp.StatusOK, PushResult{Status: "sent", Chats: len(item.Chats)})
+}
+
+// pushSubscriptions returns subscriptions of chats to pseudo feed, missing ones are stored, so pushed news are counted,
+// queued for digests and shown in pulse of chat as news of usual feeds
+func pushSubscriptions(url string, chats []int64) (subs []FeedSubscription, err error) {
+	for _, chatID := range chats {
+		sub, err := dbGetFeedSubscription(url, chatID)
+		if err == ErrorSubscriptionNotFound {
+			sub = FeedSubscription{FeedURL: url, ChatID: chatID, CreatedAt: time.Now()}
+			if err = dbAddFeedSubscription(sub); err == ErrorSubscriptionAlreadyExists {
+				sub, err = dbGetFeedSubscription(url, chatID)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return
+}
@@ -0,0 +1,134 @@
+// -*- Go -*-
+/* ------------------------------------------------ */
+/* Golang source                                    */
+/* Author: Alexei Panov <me@elemc.name> 			*/
+/* ------------------------------------------------ */
+
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+// Role is a type for user roles, greater role includes all permissions of lower roles
+type Role int
+
+// User roles
+const (
+	RoleMember Role = iota
+	RoleChatModerator
+	RoleBotAdmin
+	RoleOwner
+)
+
+var roleNames = map[Role]string{
+	RoleMember:        "member",
+	RoleChatModerator: "chat-moderator",
+	RoleBotAdmin:      "bot-admin",
+	RoleOwner:         "owner",
+}
+
+func (r Role) String() string {
+	if name, ok := roleNames[r]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// IsGlobal function returns true for roles which are granted for all chats
+func (r Role) IsGlobal() bool {
+	return r >= RoleBotAdmin
+}
+
+func parseRole(name string) (role Role, ok bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for r, n := range roleNames {
+		if n == name {
+			return r, true
+		}
+	}
+	return RoleMember, false
+}
+
+// loadOwners reads owner user IDs from `roles.owners` option
+func loadOwners() (owners []int) {
+	for _, s := range viper.GetStringSlice("roles.owners") {
+		id, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			log.Warnf("Invalid owner user ID in configuration: %s", s)
+			continue
+		}
+		owners = append(owners, id)
+	}
+	return
+}
+
+// loadChatAdminRole reads role for chat administrators from `roles.chat_admin_role` option
+func loadChatAdminRole() Role {
+	name := viper.GetString("roles.chat_admin_role")
+	if name == "" {
+		return RoleChatModerator
+	}
+	role, ok := parseRole(name)
+	if !ok || role == RoleOwner {
+		log.Warnf("Invalid role for chat administrators in configuration: %s", name)
+		return RoleChatModerator
+	}
+	return role
+}
+
+func isOwner(userID int) bool {
+	for _, id := range options.Owners {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// userStoredRole returns maximum role of user from configuration and database without chat administrators mapping
+func userStoredRole(chatID int64, user *tgbotapi.User) (role Role) {
+	if isOwner(user.ID) {
+		return RoleOwner
+	}
+
+	roles, err := dbGetUserRoles(user.ID, chatID)
+	if err != nil {
+		log.Errorf("Unable to get roles of user %s: %s", user.String(), err)
+		return RoleMember
+	}
+	for _, ur := range roles {
+		if r, ok := parseRole(ur.Role); ok && r > role {
+			role = r
+		}
+	}
+	return
+}
+
+// userRole returns effective role of user in chat
+func userRole(chat *tgbotapi.Chat, user *tgbotapi.User) (role Role) {
+	role = userStoredRole(chat.ID, user)
+	if options.ChatAdminRole > role && !chat.IsPrivate() && isUserAdmin(chat, user) {
+		role = options.ChatAdminRole
+	}
+	return
+}
+
+// userHasRole checks role of user in chat, chat administrators are checked only if it is needed
+func userHasRole(chat *tgbotapi.Chat, user *tgbotapi.User, required Role) bool {
+	if required == RoleMember {
+		return true
+	}
+	if chat == nil || user == nil {
+		return false
+	}
+	if userStoredRole(chat.ID, user) >= required {
+		return true
+	}
+	return options.ChatAdminRole >= required && !chat.IsPrivate() && isUserAdmin(chat, user)
+}